@@ -1,7 +1,7 @@
 //
 // go.notify/freedesktop :: export_test.go
 //
-//   Copyright (c) 2017-2021 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2017-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -20,6 +20,10 @@ func SetSessionBus(fn func() (*dbus.Conn, error)) func() {
 	return func() { sessionBus = save }
 }
 
+var ParseSpecVersion = parseSpecVersion
+
+const MaxActive = maxActive
+
 var MockBusMethodCall = func() *dbus.Call { return new(dbus.Call) }
 
 func init() {
@@ -27,7 +31,7 @@ func init() {
 		c.busObj = &object{
 			dest:  c.busObj.Destination(),
 			path:  c.busObj.Path(),
-			calls: []*dbus.Call{MockBusMethodCall(), MockBusMethodCall()},
+			calls: []*dbus.Call{MockBusMethodCall(), MockBusMethodCall(), MockBusMethodCall()},
 		}
 		c.obj = &object{
 			dest: iface,
@@ -36,11 +40,34 @@ func init() {
 	}
 }
 
+func (c *Client) NumBusMethodCalls() int {
+	return c.busObj.(*object).n
+}
+
+func (c *Client) NumCloseWaiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.closed)
+}
+
 func (c *Client) MockMethodCall(call *dbus.Call) {
 	obj := c.obj.(*object)
 	obj.calls = append(obj.calls, call)
 }
 
+func (c *Client) MockMethodCallHook(call *dbus.Call, fn func()) {
+	obj := c.obj.(*object)
+	if obj.hooks == nil {
+		obj.hooks = make(map[int]func())
+	}
+	obj.hooks[len(obj.calls)] = fn
+	obj.calls = append(obj.calls, call)
+}
+
+func (c *Client) MethodCall(i int) *dbus.Call {
+	return c.obj.(*object).calls[i]
+}
+
 func (c *Client) NumMethodCalls() int {
 	return c.obj.(*object).n
 }
@@ -54,6 +81,7 @@ func (c *Client) MockSignal(sig *dbus.Signal) {
 func (c *Client) ResetMock() {
 	obj := c.obj.(*object)
 	obj.calls = obj.calls[:0]
+	obj.hooks = nil
 	obj.n = 0
 }
 
@@ -61,6 +89,7 @@ type object struct {
 	dest  string
 	path  dbus.ObjectPath
 	calls []*dbus.Call
+	hooks map[int]func()
 	n     int
 }
 
@@ -86,6 +115,10 @@ func (o *object) GoWithContext(ctx context.Context, method string, flags dbus.Fl
 	call.Path = o.path
 	call.Method = method
 	call.Args = args
+	if fn, ok := o.hooks[o.n]; ok {
+		delete(o.hooks, o.n)
+		fn()
+	}
 	o.n++
 	return call
 }
@@ -1,7 +1,7 @@
 //
 // go.notify/freedesktop :: impl.go
 //
-//   Copyright (c) 2017-2019 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2017-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -11,14 +11,19 @@ package freedesktop
 import (
 	"fmt"
 	"image"
+	"image/png"
+	"net/url"
+	"os"
+	"path/filepath"
 
 	"github.com/hattya/go.notify"
 )
 
 type notifier struct {
-	c    *Client
-	name string
-	ev   map[string]*Notification
+	c     *Client
+	name  string
+	ev    map[string]*Notification
+	files []string
 }
 
 // NewNotifier returns a new Notifier.
@@ -28,9 +33,17 @@ type notifier struct {
 //   - image.Image
 //
 // Register accepts following keys and value types:
-//   - freedesktop:actions map[string]string
-//   - freedesktop:hints   map[string]interface{}
-//   - freedesktop:timeout int32
+//   - freedesktop:actions    map[string]string
+//   - freedesktop:hints      map[string]interface{}
+//   - freedesktop:image-path bool
+//   - freedesktop:sound-file string
+//   - freedesktop:sound-name string
+//   - freedesktop:timeout    int32
+//
+// If freedesktop:image-path is true, an image.Image icon is also written to
+// a temporary PNG file, and it is set as the "image-path" hint for the
+// servers which do not support the "image-data" hint. The files are removed
+// by Close.
 func NewNotifier(name string) (notify.Notifier, error) {
 	c, err := New()
 	if err != nil {
@@ -44,21 +57,17 @@ func NewNotifier(name string) (notify.Notifier, error) {
 }
 
 func (p *notifier) Close() error {
+	for _, name := range p.files {
+		os.Remove(name)
+	}
+	p.files = nil
 	return p.c.Close()
 }
 
 func (p *notifier) Register(event string, icon notify.Icon, opts map[string]interface{}) error {
 	n := &Notification{Timeout: -1}
-	switch icon := icon.(type) {
-	case nil:
-	case string:
-		n.Icon = icon
-	case image.Image:
-		if err := n.Hint("image-data", icon); err != nil {
-			return err
-		}
-	default:
-		return fmt.Errorf("unsupported icon: %T", icon)
+	if err := n.SetIcon(icon); err != nil {
+		return err
 	}
 	k := "freedesktop:actions"
 	if v, ok := opts[k]; ok {
@@ -82,6 +91,17 @@ func (p *notifier) Register(event string, icon notify.Icon, opts map[string]inte
 			return fmt.Errorf("%q expects map[string]interface{}: %T", k, v)
 		}
 	}
+	for _, k := range []string{"freedesktop:sound-file", "freedesktop:sound-name"} {
+		if v, ok := opts[k]; ok {
+			if s, ok := v.(string); ok {
+				if err := n.Hint(k[len("freedesktop:"):], s); err != nil {
+					return err
+				}
+			} else {
+				return fmt.Errorf("%q expects string: %T", k, v)
+			}
+		}
+	}
 	k = "freedesktop:timeout"
 	if v, ok := opts[k]; ok {
 		if i, err := v2i(k, v); err == nil {
@@ -90,10 +110,44 @@ func (p *notifier) Register(event string, icon notify.Icon, opts map[string]inte
 			return fmt.Errorf("%q expects int32: %T", k, v)
 		}
 	}
+	k = "freedesktop:image-path"
+	if v, ok := opts[k]; ok {
+		if b, ok := v.(bool); !ok {
+			return fmt.Errorf("%q expects bool: %T", k, v)
+		} else if img, ok := icon.(image.Image); ok && b {
+			name, err := p.writeImage(img)
+			if err != nil {
+				return err
+			}
+			u := &url.URL{
+				Scheme: "file",
+				Path:   filepath.ToSlash(name),
+			}
+			n.Hint("image-path", u.String())
+		}
+	}
 	p.ev[event] = n
 	return nil
 }
 
+// writeImage writes the specified image to a temporary PNG file, and returns
+// its name.
+func (p *notifier) writeImage(img image.Image) (string, error) {
+	f, err := os.CreateTemp("", "go.notify-*.png")
+	if err != nil {
+		return "", err
+	}
+	p.files = append(p.files, f.Name())
+	err = png.Encode(f, img)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
 func (p *notifier) Notify(event, title, body string) error {
 	n := new(Notification)
 	if ev, ok := p.ev[event]; ok {
@@ -1,7 +1,7 @@
 //
 // go.notify/freedesktop :: impl_test.go
 //
-//   Copyright (c) 2017-2020 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2017-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -10,7 +10,12 @@ package freedesktop_test
 
 import (
 	"image"
+	"image/png"
 	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/godbus/dbus/v5"
@@ -59,6 +64,9 @@ func TestNotifierRegister(t *testing.T) {
 	for _, opts := range []map[string]interface{}{
 		{"freedesktop:actions": map[string]string{"default": "Default"}},
 		{"freedesktop:hints": map[string]interface{}{"urgency": 1}},
+		{"freedesktop:image-path": true},
+		{"freedesktop:sound-file": "/usr/share/sounds/message.oga"},
+		{"freedesktop:sound-name": "message-new-instant"},
 		{"freedesktop:timeout": 0},
 	} {
 		if err := n.Register("event", "path", opts); err != nil {
@@ -70,6 +78,9 @@ func TestNotifierRegister(t *testing.T) {
 		{"freedesktop:actions": nil},
 		{"freedesktop:hints": map[string]interface{}{"urgency": math.MaxUint8 + 1}},
 		{"freedesktop:hints": nil},
+		{"freedesktop:image-path": 0},
+		{"freedesktop:sound-file": nil},
+		{"freedesktop:sound-name": 0},
 		{"freedesktop:timeout": nil},
 	} {
 		if err := n.Register("event", "path", opts); err == nil {
@@ -93,6 +104,23 @@ func TestNotifierNotify(t *testing.T) {
 	if err := n.Notify("event", "Title", "Body"); err != nil {
 		t.Fatal(err)
 	}
+	// sound
+	for _, k := range []string{"sound-file", "sound-name"} {
+		c.ResetMock()
+		c.Refresh()
+		c.MockMethodCall(&dbus.Call{Body: newServer("1.2")})
+		c.MockMethodCall(&dbus.Call{Body: []interface{}{uint32(1)}})
+		if err := n.Register("event", "path", map[string]interface{}{"freedesktop:" + k: "sound"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := n.Notify("event", "Title", "Body"); err != nil {
+			t.Fatal(err)
+		}
+		hints := c.MethodCall(1).Args[6].(map[string]dbus.Variant)
+		if g, e := hints[k], dbus.MakeVariant("sound"); !reflect.DeepEqual(g, e) {
+			t.Errorf("%v = %v, expected %v", k, g, e)
+		}
+	}
 	// unknown event
 	if err := n.Notify("", "Title", "Body"); err == nil {
 		t.Error("expected error")
@@ -102,3 +130,57 @@ func TestNotifierNotify(t *testing.T) {
 		t.Error("expected error")
 	}
 }
+
+func TestNotifierImagePath(t *testing.T) {
+	n, err := freedesktop.NewNotifier(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	c := n.Sys().(*freedesktop.Client)
+	c.MockMethodCall(&dbus.Call{Body: newServer("1.2")})
+	c.MockMethodCall(&dbus.Call{Body: []interface{}{uint32(1)}})
+	icon := image.NewRGBA(image.Rect(0, 0, 48, 48))
+	if err := n.Register("event", icon, map[string]interface{}{"freedesktop:image-path": true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify("event", "Title", "Body"); err != nil {
+		t.Fatal(err)
+	}
+	hints := c.MethodCall(1).Args[6].(map[string]dbus.Variant)
+	if _, ok := hints["image-data"]; !ok {
+		t.Error("expected image-data")
+	}
+	v, ok := hints["image-path"]
+	if !ok {
+		t.Fatal("expected image-path")
+	}
+	u, err := url.Parse(v.Value().(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := u.Scheme, "file"; g != e {
+		t.Errorf("expected %q, got %q", e, g)
+	}
+	name := filepath.FromSlash(u.Path)
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := img.Bounds(), icon.Bounds(); g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	// cleanup
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("expected %v to be removed: %v", name, err)
+	}
+}
@@ -1,7 +1,7 @@
 //
 // go.notify/freedesktop :: notify.go
 //
-//   Copyright (c) 2017-2024 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2017-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -13,9 +13,14 @@
 package freedesktop
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"image"
 	"math"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -24,12 +29,42 @@ import (
 )
 
 const (
-	path               dbus.ObjectPath = "/org/freedesktop/Notifications"
-	iface                              = "org.freedesktop.Notifications"
-	notificationClosed                 = iface + ".NotificationClosed"
-	actionInvoked                      = iface + ".ActionInvoked"
+	path                dbus.ObjectPath = "/org/freedesktop/Notifications"
+	iface                               = "org.freedesktop.Notifications"
+	notificationClosed                  = iface + ".NotificationClosed"
+	actionInvoked                       = iface + ".ActionInvoked"
+	notificationReplied                 = iface + ".NotificationReplied"
 )
 
+var signals = []string{notificationClosed, actionInvoked, notificationReplied}
+
+var (
+	ErrCapability = errors.New("notify: server lacks capability")
+	ErrImageData  = errors.New("notify: invalid image data")
+	ErrSender     = errors.New("notify: client does not receive signals")
+
+	// errors of the server, and they wrap the dbus.Error
+	ErrInvalidArgs    = errors.New("notify: invalid arguments")
+	ErrLimitsExceeded = errors.New("notify: limits exceeded")
+	ErrNotSupported   = errors.New("notify: not supported")
+	ErrNoServer       = errors.New("notify: no notification server")
+	ErrNoReply        = errors.New("notify: no reply")
+)
+
+// dbusErrors maps the names of the dbus.Error to the errors.
+var dbusErrors = map[string]error{
+	"org.freedesktop.DBus.Error.InvalidArgs":      ErrInvalidArgs,
+	"org.freedesktop.DBus.Error.InvalidSignature": ErrInvalidArgs,
+	"org.freedesktop.DBus.Error.LimitsExceeded":   ErrLimitsExceeded,
+	"org.freedesktop.DBus.Error.NoMemory":         ErrLimitsExceeded,
+	"org.freedesktop.DBus.Error.NotSupported":     ErrNotSupported,
+	"org.freedesktop.DBus.Error.UnknownMethod":    ErrNotSupported,
+	"org.freedesktop.DBus.Error.ServiceUnknown":   ErrNoServer,
+	"org.freedesktop.DBus.Error.NameHasNoOwner":   ErrNoServer,
+	"org.freedesktop.DBus.Error.NoReply":          ErrNoReply,
+	"org.freedesktop.DBus.Error.Timeout":          ErrNoReply,
+}
+
 // for testing
 var (
 	sessionBus  = dbus.SessionBus
@@ -40,6 +75,33 @@ var (
 type Client struct {
 	NotificationClosed chan NotificationClosed
 	ActionInvoked      chan ActionInvoked
+	ReplyReceived      chan ReplyReceived
+
+	// IconTheme is used to embed the icon of the Notification as the
+	// "image-data" hint if it is not nil. The icon name is passed as is when
+	// it cannot be resolved.
+	IconTheme *IconTheme
+
+	// CloseNotificationsOnClose specifies whether Close closes the
+	// notifications which were sent by the Client and have not been closed
+	// yet.
+	CloseNotificationsOnClose bool
+
+	// Strict specifies whether Notify returns an error which wraps
+	// ErrCapability when the Body has hyperlinks or images which the server
+	// does not support, instead of sending it. Notify also omits the "x"
+	// and "y" hints unless the server has the PositionCapability.
+	Strict bool
+
+	// PositionCapability is the name of the vendor specific capability
+	// which indicates that the server honors the "x" and "y" hints. The
+	// specification does not define such a capability, so the hints are
+	// always sent if it is empty.
+	PositionCapability string
+
+	// Trace is called with the method name, the arguments, and the error
+	// after each method call of the notification server if it is not nil.
+	Trace func(method string, args []interface{}, err error)
 
 	conn   *dbus.Conn
 	busObj dbus.BusObject
@@ -47,31 +109,31 @@ type Client struct {
 	c      chan *dbus.Signal
 	wg     sync.WaitGroup
 
-	mu   sync.Mutex
-	done chan struct{}
+	mu      sync.Mutex
+	done    chan struct{}
+	active  map[uint32]uint64
+	seq     uint64
+	persist map[uint32]map[string]interface{}
+	caps    []string
+	si      *ServerInfo
+	closed  map[uint32][]chan Reason
+	pending int
+	early   map[uint32]Reason
 }
 
 // New returns a new Client connected to the session bus.
 func New() (*Client, error) {
-	conn, err := sessionBus()
+	c, err := newClient()
 	if err != nil {
 		return nil, err
 	}
-	c := &Client{
-		NotificationClosed: make(chan NotificationClosed),
-		ActionInvoked:      make(chan ActionInvoked),
-		conn:               conn,
-		busObj:             conn.BusObject(),
-		obj:                conn.Object(iface, path),
-		c:                  make(chan *dbus.Signal),
-		done:               make(chan struct{}),
-	}
-	if testHookNew != nil {
-		testHookNew(c)
-	}
+	c.NotificationClosed = make(chan NotificationClosed)
+	c.ActionInvoked = make(chan ActionInvoked)
+	c.ReplyReceived = make(chan ReplyReceived)
+	c.c = make(chan *dbus.Signal)
 	// signal
 	c.conn.Signal(c.c)
-	for _, sig := range []string{notificationClosed, actionInvoked} {
+	for _, sig := range signals {
 		if err := c.addMatch(sig); err != nil {
 			return nil, err
 		}
@@ -81,8 +143,39 @@ func New() (*Client, error) {
 	return c, nil
 }
 
+// NewSender returns a new Client connected to the session bus which does not
+// subscribe to any signals. The channels of it are nil.
+//
+// This is intended for senders which never receive the signals.
+func NewSender() (*Client, error) {
+	return newClient()
+}
+
+func newClient() (*Client, error) {
+	conn, err := sessionBus()
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		conn:    conn,
+		busObj:  conn.BusObject(),
+		obj:     conn.Object(iface, path),
+		done:    make(chan struct{}),
+		active:  make(map[uint32]uint64),
+		persist: make(map[uint32]map[string]interface{}),
+		closed:  make(map[uint32][]chan Reason),
+	}
+	if testHookNew != nil {
+		testHookNew(c)
+	}
+	return c, nil
+}
+
 // Close closes the D-Bus connection.
-func (c *Client) Close() error {
+//
+// If the CloseNotificationsOnClose field is true, Close also closes the
+// active notifications before closing the connection.
+func (c *Client) Close() (err error) {
 	c.mu.Lock()
 	select {
 	case <-c.done:
@@ -91,24 +184,100 @@ func (c *Client) Close() error {
 	default:
 		close(c.done)
 	}
+	var ids []uint32
+	if c.CloseNotificationsOnClose {
+		for id := range c.active {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	}
 	c.mu.Unlock()
 
+	for _, id := range ids {
+		if e := c.CloseNotification(id); e != nil && err == nil {
+			err = e
+		}
+	}
 	c.wg.Wait()
-	return c.conn.Close()
+	if e := c.conn.Close(); e != nil {
+		err = e
+	}
+	return
 }
 
 // CloseNotification closes and removes the notification of the specified id.
 func (c *Client) CloseNotification(id uint32) error {
-	call := c.obj.Call("org.freedesktop.Notifications.CloseNotification", 0, id)
+	call := c.call("CloseNotification", id)
+	if call.Err == nil {
+		c.mu.Lock()
+		c.deactivate(id)
+		c.mu.Unlock()
+	}
 	return call.Err
 }
 
+// IsActive reports whether the notification of the specified id was sent by
+// the Client and has not been closed yet. It is useful to stop updating the
+// notification which is dismissed by the user.
+//
+// A Client which is returned by NewSender does not receive the
+// NotificationClosed signal, so the notification remains active until it is
+// closed by CloseNotification or replaced with a new id. The Client tracks up
+// to the last 256 notifications, and the older ones are regarded as closed.
+func (c *Client) IsActive(id uint32) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.active[id]
+	return ok
+}
+
+// maxActive is the maximum number of the active notifications which are
+// tracked by the Client.
+const maxActive = 256
+
+// persistHints are the hints which are carried over by Progress.
+var persistHints = []string{"transient", "resident"}
+
+// activate adds the notification of the specified id to the active ones, and
+// removes the oldest one if they exceed maxActive.
+func (c *Client) activate(id uint32, hints map[string]interface{}) {
+	c.seq++
+	c.active[id] = c.seq
+	delete(c.persist, id)
+	for _, k := range persistHints {
+		if v, ok := hints[k]; ok {
+			if c.persist[id] == nil {
+				c.persist[id] = make(map[string]interface{})
+			}
+			c.persist[id][k] = v
+		}
+	}
+	if len(c.active) > maxActive {
+		var oldest uint32
+		n := c.seq
+		for id, seq := range c.active {
+			if seq < n {
+				oldest, n = id, seq
+			}
+		}
+		c.deactivate(oldest)
+	}
+}
+
+// deactivate removes the notification of the specified id from the active
+// ones.
+func (c *Client) deactivate(id uint32) {
+	delete(c.active, id)
+	delete(c.persist, id)
+}
+
 // GetCapabilities retrieves capabilities that the server implements.
 //
 // See https://developer.gnome.org/notification-spec/#command-get-capabilities
 // for available capabilities.
 func (c *Client) GetCapabilities() (caps []string, err error) {
-	call := c.obj.Call("org.freedesktop.Notifications.GetCapabilities", 0)
+	call := c.call("GetCapabilities")
 	if call.Err != nil {
 		err = call.Err
 	} else {
@@ -117,9 +286,64 @@ func (c *Client) GetCapabilities() (caps []string, err error) {
 	return
 }
 
+// HasCapability reports whether the server implements the specified
+// capability. The capabilities are retrieved only once and cached until
+// Refresh is called.
+func (c *Client) HasCapability(name string) (bool, error) {
+	c.mu.Lock()
+	caps := c.caps
+	c.mu.Unlock()
+	if caps == nil {
+		var err error
+		if caps, err = c.GetCapabilities(); err != nil {
+			return false, err
+		}
+		if caps == nil {
+			caps = []string{}
+		}
+		c.mu.Lock()
+		c.caps = caps
+		c.mu.Unlock()
+	}
+	for _, s := range caps {
+		if s == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ServerInfo returns the information of the server. It is retrieved only
+// once and cached until Refresh is called.
+func (c *Client) ServerInfo() (ServerInfo, error) {
+	c.mu.Lock()
+	si := c.si
+	c.mu.Unlock()
+	if si == nil {
+		v, err := c.GetServerInformation()
+		if err != nil {
+			return ServerInfo{}, err
+		}
+		si = &v
+		c.mu.Lock()
+		c.si = si
+		c.mu.Unlock()
+	}
+	return *si, nil
+}
+
+// Refresh discards the cached information of the server.
+func (c *Client) Refresh() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.caps = nil
+	c.si = nil
+}
+
 // GetServerInformation retrieves the information of the server.
 func (c *Client) GetServerInformation() (si ServerInfo, err error) {
-	call := c.obj.Call("org.freedesktop.Notifications.GetServerInformation", 0)
+	call := c.call("GetServerInformation")
 	if call.Err != nil {
 		err = call.Err
 	} else {
@@ -129,19 +353,53 @@ func (c *Client) GetServerInformation() (si ServerInfo, err error) {
 }
 
 // Notify sends a notification to the server.
+//
+// If the ID field of the Notification is not zero, the server is requested
+// to replace the existing notification which has the ID. The server may
+// return a new id when it has been closed or the server does not support
+// replacing, see Replace.
 func (c *Client) Notify(n *Notification) (id uint32, err error) {
+	return c.notify(n, nil)
+}
+
+// notify sends the notification. If ch is not nil, it receives the reason of
+// the NotificationClosed signal of the notification.
+func (c *Client) notify(n *Notification, ch chan Reason) (id uint32, err error) {
+	if c.Strict {
+		if err = c.checkBody(n.Body); err != nil {
+			return
+		}
+	}
+	src := n.Hints
+	if c.Strict && c.PositionCapability != "" {
+		if src, err = c.checkPosition(src); err != nil {
+			return
+		}
+	}
+	if c.IconTheme != nil && n.Icon != "" {
+		if _, ok := src["image-data"]; !ok {
+			if data, err := c.IconTheme.Resolve(n.Icon); err == nil {
+				m := make(map[string]interface{}, len(src)+1)
+				for k, v := range src {
+					m[k] = v
+				}
+				src = m
+				src["image-data"] = data
+			}
+		}
+	}
 	hints := make(map[string]dbus.Variant)
-	if len(n.Hints) != 0 {
+	if len(src) != 0 {
 		var si ServerInfo
-		si, err = c.GetServerInformation()
+		si, err = c.ServerInfo()
 		if err != nil {
 			return
 		}
 		var major, minor int
-		if _, err = fmt.Sscanf(si.SpecVersion, "%v.%v", &major, &minor); err != nil {
+		if major, minor, err = parseSpecVersion(si.SpecVersion); err != nil {
 			return
 		}
-		for k, v := range n.Hints {
+		for k, v := range src {
 			switch k {
 			case "image-data":
 				switch {
@@ -163,11 +421,45 @@ func (c *Client) Notify(n *Notification) (id uint32, err error) {
 					k = "image_path"
 				}
 			}
-			hints[k] = dbus.MakeVariant(v)
+			if vv, ok := v.(dbus.Variant); ok {
+				hints[k] = vv
+			} else {
+				hints[k] = dbus.MakeVariant(v)
+			}
 		}
 	}
 
-	call := c.obj.Call("org.freedesktop.Notifications.Notify", 0, n.Name, n.ID, n.Icon, n.Summary, n.Body, n.Actions, hints, n.Timeout)
+	// record the NotificationClosed signals which arrive before the reply
+	c.mu.Lock()
+	c.pending++
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if err == nil {
+			if r, ok := c.early[id]; ok {
+				if ch != nil {
+					ch <- r
+				}
+			} else {
+				if n.ID != 0 && id != n.ID {
+					// the replaced notification has been closed
+					c.deactivate(n.ID)
+				}
+				c.activate(id, n.Hints)
+				if ch != nil {
+					c.closed[id] = append(c.closed[id], ch)
+				}
+			}
+		}
+		c.pending--
+		if c.pending == 0 {
+			c.early = nil
+		}
+	}()
+
+	call := c.call("Notify", n.Name, n.ID, n.Icon, n.Summary, n.Body, n.Actions, hints, n.Timeout)
 	if call.Err != nil {
 		err = call.Err
 	} else {
@@ -176,6 +468,189 @@ func (c *Client) Notify(n *Notification) (id uint32, err error) {
 	return
 }
 
+// bodyTags maps the markup tags to the capabilities which the server
+// requires to honor them.
+var bodyTags = []struct {
+	re  *regexp.Regexp
+	cap string
+}{
+	{regexp.MustCompile(`(?i)<a[\s>]`), "body-hyperlinks"},
+	{regexp.MustCompile(`(?i)<img[\s/>]`), "body-images"},
+}
+
+func (c *Client) checkBody(body string) error {
+	for _, t := range bodyTags {
+		if !t.re.MatchString(body) {
+			continue
+		}
+		switch ok, err := c.HasCapability(t.cap); {
+		case err != nil:
+			return err
+		case !ok:
+			return fmt.Errorf("%w: %v", ErrCapability, t.cap)
+		}
+	}
+	return nil
+}
+
+// checkPosition returns the hints without "x" and "y" unless the server has
+// the PositionCapability.
+func (c *Client) checkPosition(hints map[string]interface{}) (map[string]interface{}, error) {
+	_, x := hints["x"]
+	_, y := hints["y"]
+	if !x && !y {
+		return hints, nil
+	}
+	switch ok, err := c.HasCapability(c.PositionCapability); {
+	case err != nil:
+		return nil, err
+	case ok:
+		return hints, nil
+	}
+	m := make(map[string]interface{}, len(hints))
+	for k, v := range hints {
+		if k != "x" && k != "y" {
+			m[k] = v
+		}
+	}
+	return m, nil
+}
+
+// parseSpecVersion parses the leading "major[.minor]" of the specified
+// version. Any trailing components and non-numeric suffixes are ignored, and
+// minor defaults to 0.
+func parseSpecVersion(v string) (major, minor int, err error) {
+	num := func(s string) (int, string) {
+		i := 0
+		for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+			i++
+		}
+		n, _ := strconv.Atoi(s[:i])
+		return n, s[i:]
+	}
+
+	s := strings.TrimSpace(v)
+	if s == "" || s[0] < '0' || '9' < s[0] {
+		return 0, 0, fmt.Errorf("notify: invalid spec version: %q", v)
+	}
+	major, s = num(s)
+	if len(s) > 1 && s[0] == '.' {
+		minor, _ = num(s[1:])
+	}
+	return
+}
+
+// Replace is like Notify but also reports whether the server replaced the
+// existing notification, that is, the ID field of the Notification is not
+// zero and the returned id equals it.
+func (c *Client) Replace(n *Notification) (id uint32, replaced bool, err error) {
+	id, err = c.Notify(n)
+	if err == nil {
+		replaced = n.ID != 0 && id == n.ID
+	}
+	return
+}
+
+// NotifyAndAwaitClose sends a notification, and waits for the
+// NotificationClosed signal of it. It returns the reason of the signal, or
+// the error of ctx if ctx is done before that. The signal is also delivered
+// to the NotificationClosed channel.
+//
+// It returns ErrSender if the Client was created by NewSender.
+func (c *Client) NotifyAndAwaitClose(ctx context.Context, n *Notification) (Reason, error) {
+	if c.c == nil {
+		return 0, ErrSender
+	}
+	ch := make(chan Reason, 1)
+	id, err := c.notify(n, ch)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		chans := c.closed[id]
+		for i := range chans {
+			if chans[i] == ch {
+				chans = append(chans[:i], chans[i+1:]...)
+				break
+			}
+		}
+		if len(chans) == 0 {
+			delete(c.closed, id)
+		} else {
+			c.closed[id] = chans
+		}
+	}()
+
+	select {
+	case r := <-ch:
+		return r, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-c.done:
+		return 0, dbus.ErrClosed
+	}
+}
+
+// Progress sends a notification which displays the progress of percent with
+// the "value" hint. It updates the notification of the specified id in place
+// if it is not 0, and returns the id for subsequent updates. The percent must
+// be in the range from 0 to 100.
+//
+// The "transient" and "resident" hints of the active notification of the
+// specified id are carried over.
+func (c *Client) Progress(id uint32, summary string, percent int) (uint32, error) {
+	if percent < 0 || 100 < percent {
+		return 0, fmt.Errorf("percent out of range [0, 100]: %v", percent)
+	}
+	n := &Notification{
+		ID:      id,
+		Summary: summary,
+		Timeout: -1,
+	}
+	c.mu.Lock()
+	if len(c.persist[id]) != 0 {
+		n.Hints = make(map[string]interface{})
+		for k, v := range c.persist[id] {
+			n.Hints[k] = v
+		}
+	}
+	c.mu.Unlock()
+	if err := n.Hint("value", percent); err != nil {
+		return 0, err
+	}
+	return c.Notify(n)
+}
+
+// wrapError wraps the dbus.Error with the corresponding error, so that it
+// can be tested by errors.Is.
+func wrapError(err error) error {
+	var name string
+	switch v := err.(type) {
+	case dbus.Error:
+		name = v.Name
+	case *dbus.Error:
+		name = v.Name
+	default:
+		return err
+	}
+	if e, ok := dbusErrors[name]; ok {
+		return fmt.Errorf("%w: %w", e, err)
+	}
+	return err
+}
+
+func (c *Client) call(method string, args ...interface{}) *dbus.Call {
+	call := c.obj.Call(iface+"."+method, 0, args...)
+	if c.Trace != nil {
+		c.Trace(method, args, call.Err)
+	}
+	call.Err = wrapError(call.Err)
+	return call
+}
+
 func (c *Client) addMatch(sig string) error {
 	i := strings.LastIndexByte(sig, '.')
 	call := c.busObj.Call("org.freedesktop.DBus.AddMatch", 0, fmt.Sprintf(`type='signal',interface='%v',member='%v'`, sig[:i], sig[i+1:]))
@@ -193,9 +668,11 @@ func (c *Client) signal() {
 
 	var closed chan NotificationClosed
 	var invoked chan ActionInvoked
-	var closedIdx, invokedIdx int
+	var replied chan ReplyReceived
+	var closedIdx, invokedIdx, repliedIdx int
 	closedBuf := make([]NotificationClosed, 1)
 	invokedBuf := make([]ActionInvoked, 1)
+	repliedBuf := make([]ReplyReceived, 1)
 
 	for {
 		select {
@@ -207,9 +684,24 @@ func (c *Client) signal() {
 						closed = c.NotificationClosed
 						closedIdx = 1
 					}
+					id := sig.Body[0].(uint32)
+					reason := Reason(sig.Body[1].(uint32))
+					c.mu.Lock()
+					if _, ok := c.active[id]; !ok && c.pending > 0 {
+						if c.early == nil {
+							c.early = make(map[uint32]Reason)
+						}
+						c.early[id] = reason
+					}
+					c.deactivate(id)
+					for _, ch := range c.closed[id] {
+						ch <- reason
+					}
+					delete(c.closed, id)
+					c.mu.Unlock()
 					closedBuf = append(closedBuf, NotificationClosed{
-						ID:     sig.Body[0].(uint32),
-						Reason: Reason(sig.Body[1].(uint32)),
+						ID:     id,
+						Reason: reason,
 					})
 				case actionInvoked:
 					if invoked == nil {
@@ -220,6 +712,15 @@ func (c *Client) signal() {
 						ID:  sig.Body[0].(uint32),
 						Key: sig.Body[1].(string),
 					})
+				case notificationReplied:
+					if replied == nil {
+						replied = c.ReplyReceived
+						repliedIdx = 1
+					}
+					repliedBuf = append(repliedBuf, ReplyReceived{
+						ID:   sig.Body[0].(uint32),
+						Text: sig.Body[1].(string),
+					})
 				}
 			}
 		case closed <- closedBuf[closedIdx]:
@@ -238,8 +739,16 @@ func (c *Client) signal() {
 			} else {
 				invokedIdx++
 			}
+		case replied <- repliedBuf[repliedIdx]:
+			if repliedIdx == len(repliedBuf)-1 {
+				replied = nil
+				repliedIdx = 0
+				repliedBuf = repliedBuf[:1]
+			} else {
+				repliedIdx++
+			}
 		case <-c.done:
-			for _, sig := range []string{notificationClosed, actionInvoked} {
+			for _, sig := range signals {
 				c.removeMatch(sig)
 			}
 			return
@@ -272,6 +781,13 @@ func (n *Notification) Action(key, label string) {
 	n.Actions = append(n.Actions, key, label)
 }
 
+// InlineReply adds the "inline-reply" action to the Notification. The text
+// entered by the user is delivered as the ReplyReceived if the server
+// implements the "inline-reply" capability.
+func (n *Notification) InlineReply(label string) {
+	n.Action(InlineReplyKey, label)
+}
+
 // Hint adds (or replaces) the specified hint to the Notification.
 //
 // See https://developer.gnome.org/notification-spec/#hints for available
@@ -286,7 +802,13 @@ func (n *Notification) Hint(name string, value interface{}) error {
 		name = "image-data"
 		switch v := value.(type) {
 		case *ImageData:
+			if err = v.Validate(); err != nil {
+				return err
+			}
 		case ImageData:
+			if err = v.Validate(); err != nil {
+				return err
+			}
 			value = &v
 		case image.Image:
 			if value, err = NewImageData(v); err != nil {
@@ -295,10 +817,18 @@ func (n *Notification) Hint(name string, value interface{}) error {
 		}
 	case "image-path", "image_path":
 		name = "image-path"
-	case "x", "y":
+	case "value", "x", "y":
 		if value, err = v2i(name, value); err != nil {
 			return err
 		}
+	case "category":
+		switch v := value.(type) {
+		case Category:
+			value = string(v)
+		case string:
+		default:
+			return fmt.Errorf("%q expects string: %T", name, value)
+		}
 	case "urgency":
 		if value, err = v2y(name, value); err != nil {
 			return err
@@ -308,6 +838,74 @@ func (n *Notification) Hint(name string, value interface{}) error {
 	return nil
 }
 
+// SetIcon sets the specified icon to the Notification. A string is set to
+// the Icon as an icon name or a URI, and an image.Image is set as the
+// "image-data" hint. It returns an error if the type of icon is unsupported.
+func (n *Notification) SetIcon(icon interface{}) error {
+	switch icon := icon.(type) {
+	case nil:
+	case string:
+		n.Icon = icon
+	case image.Image:
+		return n.Hint("image-data", icon)
+	default:
+		return fmt.Errorf("unsupported icon: %T", icon)
+	}
+	return nil
+}
+
+// SetPosition sets the "x" and "y" hints to the Notification, which specify
+// the screen position to point to. They may be omitted when the Client is
+// Strict, see Client.
+func (n *Notification) SetPosition(x, y int) error {
+	if err := n.Hint("x", x); err != nil {
+		return err
+	}
+	return n.Hint("y", y)
+}
+
+// SetCategory sets the "category" hint to the Notification.
+func (n *Notification) SetCategory(c Category) error {
+	return n.Hint("category", c)
+}
+
+// HintVariant adds (or replaces) the specified hint to the Notification as
+// is. It is sent with the signature of v, which is useful for the hints not
+// known by Hint.
+func (n *Notification) HintVariant(name string, v dbus.Variant) {
+	if n.Hints == nil {
+		n.Hints = make(map[string]interface{})
+	}
+	n.Hints[name] = v
+}
+
+// The following methods set the vendor specific hints, and they are ignored
+// by the other servers.
+
+// SetDunstStackTag sets the "x-dunst-stack-tag" hint to the Notification.
+// Dunst replaces the notification which has the same tag.
+func (n *Notification) SetDunstStackTag(tag string) {
+	n.HintVariant("x-dunst-stack-tag", dbus.MakeVariant(tag))
+}
+
+// SetKDEDisplayAppName sets the "x-kde-display-appname" hint to the
+// Notification. KDE displays it as the application name.
+func (n *Notification) SetKDEDisplayAppName(name string) {
+	n.HintVariant("x-kde-display-appname", dbus.MakeVariant(name))
+}
+
+// SetKDEOriginName sets the "x-kde-origin-name" hint to the Notification.
+// KDE displays it as the origin of the notification.
+func (n *Notification) SetKDEOriginName(name string) {
+	n.HintVariant("x-kde-origin-name", dbus.MakeVariant(name))
+}
+
+// SetKDEURLs sets the "x-kde-urls" hint to the Notification. KDE displays
+// the previews of them.
+func (n *Notification) SetKDEURLs(urls ...string) {
+	n.HintVariant("x-kde-urls", dbus.MakeVariant(urls))
+}
+
 func v2i(name string, value interface{}) (i int32, err error) {
 	int2i := func(i int64) (int32, bool) {
 		if math.MinInt32 <= i && i <= math.MaxInt32 {
@@ -433,9 +1031,36 @@ func NewImageData(img image.Image) (*ImageData, error) {
 		data.NumChannels = 4
 		data.Data = img.Pix
 	}
+	if err := data.Validate(); err != nil {
+		return nil, err
+	}
 	return data, nil
 }
 
+// Validate reports whether the raw image data structure is consistent. It
+// returns an error wrapping ErrImageData if Stride is less than the number
+// of bytes of a row, or Data is shorter than Stride * (Height - 1) plus the
+// number of bytes of a row.
+func (d *ImageData) Validate() error {
+	switch {
+	case d.Width < 0 || d.Height < 0:
+		return fmt.Errorf("%w: invalid size %vx%v", ErrImageData, d.Width, d.Height)
+	case d.NumChannels <= 0 || d.BitsPerSample <= 0 || d.BitsPerSample%8 != 0:
+		return fmt.Errorf("%w: invalid format %v channels of %v bits", ErrImageData, d.NumChannels, d.BitsPerSample)
+	}
+	row := int64(d.Width) * int64(d.NumChannels) * int64(d.BitsPerSample/8)
+	if int64(d.Stride) < row {
+		return fmt.Errorf("%w: stride %v is less than %v", ErrImageData, d.Stride, row)
+	}
+	if d.Height > 0 {
+		// the last row may not be padded to Stride
+		if n := int64(d.Stride)*int64(d.Height-1) + row; int64(len(d.Data)) < n {
+			return fmt.Errorf("%w: data length %v is less than %v", ErrImageData, len(d.Data), n)
+		}
+	}
+	return nil
+}
+
 // ServerInfo represents the information of a server.
 type ServerInfo struct {
 	Name        string
@@ -450,6 +1075,37 @@ type NotificationClosed struct {
 	Reason Reason
 }
 
+// Category represents a type of the Notification. Vendor specific categories
+// should be prefixed with "x-vendor.".
+//
+// See https://specifications.freedesktop.org/notification-spec/latest/categories.html
+// for details.
+type Category string
+
+// List of categories for the Notification.
+const (
+	CategoryDevice              Category = "device"
+	CategoryDeviceAdded         Category = "device.added"
+	CategoryDeviceError         Category = "device.error"
+	CategoryDeviceRemoved       Category = "device.removed"
+	CategoryEmail               Category = "email"
+	CategoryEmailArrived        Category = "email.arrived"
+	CategoryEmailBounced        Category = "email.bounced"
+	CategoryIM                  Category = "im"
+	CategoryIMError             Category = "im.error"
+	CategoryIMReceived          Category = "im.received"
+	CategoryNetwork             Category = "network"
+	CategoryNetworkConnected    Category = "network.connected"
+	CategoryNetworkDisconnected Category = "network.disconnected"
+	CategoryNetworkError        Category = "network.error"
+	CategoryPresence            Category = "presence"
+	CategoryPresenceOffline     Category = "presence.offline"
+	CategoryPresenceOnline      Category = "presence.online"
+	CategoryTransfer            Category = "transfer"
+	CategoryTransferComplete    Category = "transfer.complete"
+	CategoryTransferError       Category = "transfer.error"
+)
+
 // Reason represents a reason of the NotificationClosed signal.
 type Reason uint32
 
@@ -478,3 +1134,12 @@ type ActionInvoked struct {
 	ID  uint32
 	Key string
 }
+
+// InlineReplyKey is the action key for the inline reply.
+const InlineReplyKey = "inline-reply"
+
+// ReplyReceived represents a NotificationReplied signal.
+type ReplyReceived struct {
+	ID   uint32
+	Text string
+}
@@ -1,7 +1,7 @@
 //
 // go.notify/freedesktop :: notify_test.go
 //
-//   Copyright (c) 2017-2020 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2017-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -9,12 +9,17 @@
 package freedesktop_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"image"
 	"io"
 	"math"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/godbus/dbus/v5"
 	"github.com/hattya/go.notify/freedesktop"
@@ -52,6 +57,45 @@ func TestNewError(t *testing.T) {
 	}
 }
 
+func TestNewSender(t *testing.T) {
+	c, err := freedesktop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := c.NumBusMethodCalls(), 3; g != e {
+		t.Errorf("bus object calls %v times, expected %v", g, e)
+	}
+	c.Close()
+
+	c, err = freedesktop.NewSender()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if g, e := c.NumBusMethodCalls(), 0; g != e {
+		t.Errorf("bus object calls %v times, expected %v", g, e)
+	}
+	if c.NotificationClosed != nil || c.ActionInvoked != nil || c.ReplyReceived != nil {
+		t.Error("expected nil channels")
+	}
+	c.MockMethodCall(&dbus.Call{Body: []interface{}{uint32(1)}})
+	if id, err := c.Notify(new(freedesktop.Notification)); err != nil {
+		t.Fatal(err)
+	} else if id != 1 {
+		t.Errorf("expected 1, got %v", id)
+	}
+	// error
+	restore := freedesktop.SetSessionBus(func() (*dbus.Conn, error) {
+		return nil, dbus.ErrClosed
+	})
+	defer restore()
+
+	if _, err := freedesktop.NewSender(); err == nil {
+		t.Error("expected error")
+	}
+}
+
 func TestClose(t *testing.T) {
 	c, err := freedesktop.New()
 	if err != nil {
@@ -65,6 +109,44 @@ func TestClose(t *testing.T) {
 	}
 }
 
+func TestCloseNotificationsOnClose(t *testing.T) {
+	c, err := freedesktop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.CloseNotificationsOnClose = true
+
+	for i := uint32(1); i < 4; i++ {
+		c.MockMethodCall(&dbus.Call{Body: []interface{}{i}})
+		if _, err := c.Notify(new(freedesktop.Notification)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.MockSignal(&dbus.Signal{
+		Name: "NotificationClosed",
+		Body: []interface{}{uint32(2), uint32(freedesktop.ReasonDismissed)},
+	})
+	<-c.NotificationClosed
+
+	c.MockMethodCall(new(dbus.Call))
+	c.MockMethodCall(new(dbus.Call))
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := c.NumMethodCalls(), 5; g != e {
+		t.Fatalf("object calls %v times, expected %v", g, e)
+	}
+	for i, id := range []uint32{1, 3} {
+		call := c.MethodCall(3 + i)
+		if g, e := call.Method, "org.freedesktop.Notifications.CloseNotification"; g != e {
+			t.Errorf("method = %v, expected %v", g, e)
+		}
+		if g, e := call.Args[0], id; g != e {
+			t.Errorf("id = %v, expected %v", g, e)
+		}
+	}
+}
+
 func TestCloseNotification(t *testing.T) {
 	c, err := freedesktop.New()
 	if err != nil {
@@ -116,6 +198,274 @@ func TestGetCapabilities(t *testing.T) {
 	}
 }
 
+func TestNotifyStrict(t *testing.T) {
+	c, err := freedesktop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.Strict = true
+	for _, tt := range []struct {
+		caps []string
+		body string
+		err  bool
+	}{
+		{[]string{}, `<a href="https://example.com/">body</a>`, true},
+		{[]string{}, `<img src="icon.png" alt="body"/>`, true},
+		{[]string{"body-hyperlinks"}, `<a href="https://example.com/">body</a>`, false},
+		{[]string{"body-hyperlinks"}, `<A HREF="https://example.com/">body</A>`, false},
+		{[]string{"body-hyperlinks"}, `<img src="icon.png" alt="body"/>`, true},
+		{[]string{"body-images"}, `<img src="icon.png" alt="body"/>`, false},
+		{[]string{"body-hyperlinks", "body-images"}, `<a href="https://example.com/"><img src="icon.png"/></a>`, false},
+	} {
+		c.Refresh()
+		c.ResetMock()
+		c.MockMethodCall(&dbus.Call{Body: []interface{}{tt.caps}})
+		if !tt.err {
+			c.MockMethodCall(&dbus.Call{Body: []interface{}{uint32(1)}})
+		}
+		_, err := c.Notify(&freedesktop.Notification{Body: tt.body})
+		switch {
+		case tt.err && !errors.Is(err, freedesktop.ErrCapability):
+			t.Errorf("%q: expected ErrCapability, got %#v", tt.body, err)
+		case !tt.err && err != nil:
+			t.Errorf("%q: unexpected error: %v", tt.body, err)
+		}
+	}
+	// no tags
+	for _, body := range []string{"body", "<b>body</b>", "<i>a</i> <u>img</u>"} {
+		c.Refresh()
+		c.ResetMock()
+		c.MockMethodCall(&dbus.Call{Body: []interface{}{uint32(1)}})
+		if _, err := c.Notify(&freedesktop.Notification{Body: body}); err != nil {
+			t.Errorf("%q: unexpected error: %v", body, err)
+		}
+		if g, e := c.NumMethodCalls(), 1; g != e {
+			t.Errorf("%q: object calls %v times, expected %v", body, g, e)
+		}
+	}
+	// error
+	c.Refresh()
+	c.ResetMock()
+	c.MockMethodCall(&dbus.Call{Err: dbus.ErrMsgUnknownMethod})
+	if _, err := c.Notify(&freedesktop.Notification{Body: "<a>body</a>"}); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestNotifyPosition(t *testing.T) {
+	c, err := freedesktop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	n := new(freedesktop.Notification)
+	if err := n.SetPosition(100, 200); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.SetCategory(freedesktop.CategoryDevice); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		strict bool
+		cap    string
+		caps   []string
+		hints  []string
+	}{
+		{false, "", nil, []string{"category", "x", "y"}},
+		{false, "x-vendor-positioning", nil, []string{"category", "x", "y"}},
+		{true, "", nil, []string{"category", "x", "y"}},
+		{true, "x-vendor-positioning", []string{"x-vendor-positioning"}, []string{"category", "x", "y"}},
+		{true, "x-vendor-positioning", []string{"body"}, []string{"category"}},
+	} {
+		c.Strict = tt.strict
+		c.PositionCapability = tt.cap
+		c.Refresh()
+		c.ResetMock()
+		if tt.caps != nil {
+			c.MockMethodCall(&dbus.Call{Body: []interface{}{tt.caps}})
+		}
+		c.MockMethodCall(&dbus.Call{Body: []interface{}{"name", "vendor", "version", "1.2"}})
+		c.MockMethodCall(&dbus.Call{Body: []interface{}{uint32(1)}})
+		if _, err := c.Notify(n); err != nil {
+			t.Fatal(err)
+		}
+		call := c.MethodCall(c.NumMethodCalls() - 1)
+		var hints []string
+		for k := range call.Args[6].(map[string]dbus.Variant) {
+			hints = append(hints, k)
+		}
+		sort.Strings(hints)
+		if g, e := hints, tt.hints; !reflect.DeepEqual(g, e) {
+			t.Errorf("expected %v, got %v", e, g)
+		}
+	}
+	if g, e := len(n.Hints), 3; g != e {
+		t.Errorf("expected %v hints, got %v", e, g)
+	}
+	// error
+	c.Refresh()
+	c.ResetMock()
+	c.MockMethodCall(&dbus.Call{Err: dbus.ErrMsgUnknownMethod})
+	if _, err := c.Notify(n); err == nil {
+		t.Error("expected error")
+	}
+	if err := n.SetPosition(math.MaxInt32+1, 0); err == nil {
+		t.Error("expected error")
+	}
+	if err := n.SetPosition(0, math.MinInt32-1); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestHasCapability(t *testing.T) {
+	c, err := freedesktop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.MockMethodCall(&dbus.Call{Body: []interface{}{[]string{"actions", "body"}}})
+	for _, tt := range []struct {
+		name string
+		ok   bool
+	}{
+		{"actions", true},
+		{"body", true},
+		{"sound", false},
+	} {
+		ok, err := c.HasCapability(tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tt.ok {
+			t.Errorf("HasCapability(%q) = %v, expected %v", tt.name, ok, tt.ok)
+		}
+	}
+	if g, e := c.NumMethodCalls(), 1; g != e {
+		t.Errorf("object calls %v times, expected %v", g, e)
+	}
+	// refresh
+	c.Refresh()
+	c.MockMethodCall(&dbus.Call{Body: []interface{}{[]string{"sound"}}})
+	if ok, err := c.HasCapability("sound"); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Error("expected true")
+	}
+	if g, e := c.NumMethodCalls(), 2; g != e {
+		t.Errorf("object calls %v times, expected %v", g, e)
+	}
+	// error
+	c.Refresh()
+	c.MockMethodCall(&dbus.Call{Err: dbus.ErrMsgUnknownMethod})
+	if _, err := c.HasCapability("sound"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	c, err := freedesktop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	n := &freedesktop.Notification{
+		Name:    name,
+		Summary: "Summary",
+		Actions: []string{"default", "Default"},
+		Timeout: -1,
+	}
+	for _, tt := range []struct {
+		name string
+		err  error
+	}{
+		{"org.freedesktop.DBus.Error.InvalidArgs", freedesktop.ErrInvalidArgs},
+		{"org.freedesktop.DBus.Error.InvalidSignature", freedesktop.ErrInvalidArgs},
+		{"org.freedesktop.DBus.Error.LimitsExceeded", freedesktop.ErrLimitsExceeded},
+		{"org.freedesktop.DBus.Error.NoMemory", freedesktop.ErrLimitsExceeded},
+		{"org.freedesktop.DBus.Error.NotSupported", freedesktop.ErrNotSupported},
+		{"org.freedesktop.DBus.Error.UnknownMethod", freedesktop.ErrNotSupported},
+		{"org.freedesktop.DBus.Error.ServiceUnknown", freedesktop.ErrNoServer},
+		{"org.freedesktop.DBus.Error.NameHasNoOwner", freedesktop.ErrNoServer},
+		{"org.freedesktop.DBus.Error.NoReply", freedesktop.ErrNoReply},
+		{"org.freedesktop.DBus.Error.Timeout", freedesktop.ErrNoReply},
+	} {
+		for _, e := range []error{
+			dbus.Error{Name: tt.name},
+			dbus.NewError(tt.name, nil),
+		} {
+			c.MockMethodCall(&dbus.Call{Err: e})
+			_, err := c.Notify(n)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%v: expected %v, got %#v", tt.name, tt.err, err)
+			}
+			var de dbus.Error
+			if _, ok := e.(dbus.Error); ok && !errors.As(err, &de) {
+				t.Errorf("%v: expected dbus.Error, got %#v", tt.name, err)
+			}
+		}
+	}
+	// unknown error
+	e := dbus.Error{Name: "org.freedesktop.DBus.Error.Failed"}
+	c.MockMethodCall(&dbus.Call{Err: e})
+	if _, err := c.Notify(n); !reflect.DeepEqual(err, e) {
+		t.Errorf("expected %#v, got %#v", e, err)
+	}
+	c.MockMethodCall(&dbus.Call{Err: dbus.ErrClosed})
+	if _, err := c.Notify(n); err != dbus.ErrClosed {
+		t.Errorf("expected %#v, got %#v", dbus.ErrClosed, err)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	c, err := freedesktop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	type trace struct {
+		method string
+		args   []interface{}
+		err    error
+	}
+	var traces []trace
+	c.Trace = func(method string, args []interface{}, err error) {
+		traces = append(traces, trace{method, args, err})
+	}
+
+	c.MockMethodCall(&dbus.Call{Body: []interface{}{[]string{"body"}}})
+	if _, err := c.GetCapabilities(); err != nil {
+		t.Fatal(err)
+	}
+	c.MockMethodCall(&dbus.Call{Body: []interface{}{uint32(1)}})
+	n := &freedesktop.Notification{
+		Name:    name,
+		Summary: "Summary",
+		Timeout: -1,
+	}
+	if _, err := c.Notify(n); err != nil {
+		t.Fatal(err)
+	}
+	c.MockMethodCall(&dbus.Call{Err: dbus.ErrMsgUnknownMethod})
+	if err := c.CloseNotification(1); err == nil {
+		t.Fatal("expected error")
+	}
+
+	e := []trace{
+		{"GetCapabilities", nil, nil},
+		{"Notify", []interface{}{name, uint32(0), "", "Summary", "", []string(nil), map[string]dbus.Variant{}, int32(-1)}, nil},
+		{"CloseNotification", []interface{}{uint32(1)}, dbus.ErrMsgUnknownMethod},
+	}
+	if !reflect.DeepEqual(traces, e) {
+		t.Errorf("expected %v, got %v", e, traces)
+	}
+}
+
 func TestGetServerInformation(t *testing.T) {
 	c, err := freedesktop.New()
 	if err != nil {
@@ -153,6 +503,63 @@ func TestGetServerInformation(t *testing.T) {
 	}
 }
 
+func TestServerInfo(t *testing.T) {
+	c, err := freedesktop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	rv := newServer("1.2")
+	e := freedesktop.ServerInfo{
+		Name:        rv[0].(string),
+		Vendor:      rv[1].(string),
+		Version:     rv[2].(string),
+		SpecVersion: rv[3].(string),
+	}
+	c.ResetMock()
+	c.MockMethodCall(&dbus.Call{Body: rv})
+	c.MockMethodCall(&dbus.Call{Body: []interface{}{uint32(1)}})
+	for i := 0; i < 3; i++ {
+		switch si, err := c.ServerInfo(); {
+		case err != nil:
+			t.Fatal(err)
+		case si != e:
+			t.Errorf("ServerInfo() = %v, expected %v", si, e)
+		}
+	}
+	// reused by Notify
+	n := new(freedesktop.Notification)
+	if err := n.Hint("image-path", "path"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Notify(n); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := c.NumMethodCalls(), 2; g != e {
+		t.Errorf("object calls %v times, expected %v", g, e)
+	}
+	// refresh
+	c.ResetMock()
+	c.Refresh()
+	c.MockMethodCall(&dbus.Call{Body: newServer("1.1")})
+	if si, err := c.ServerInfo(); err != nil {
+		t.Fatal(err)
+	} else if g, e := si.SpecVersion, "1.1"; g != e {
+		t.Errorf("ServerInfo().SpecVersion = %v, expected %v", g, e)
+	}
+	if g, e := c.NumMethodCalls(), 1; g != e {
+		t.Errorf("object calls %v times, expected %v", g, e)
+	}
+	// error
+	c.ResetMock()
+	c.Refresh()
+	c.MockMethodCall(&dbus.Call{Err: dbus.ErrMsgUnknownMethod})
+	if _, err := c.ServerInfo(); err == nil {
+		t.Error("expected error")
+	}
+}
+
 func TestNotify(t *testing.T) {
 	c, err := freedesktop.New()
 	if err != nil {
@@ -167,9 +574,10 @@ func TestNotify(t *testing.T) {
 		{"image-data", image.NewGray(image.Rect(0, 0, 48, 48))},
 		{"image-path", "path"},
 	} {
-		for _, ver := range []string{"1.0", "1.1", "1.2"} {
+		for _, ver := range []string{"1", "1.0", "1.1", "1.2", "1.2.1"} {
 			rv := uint32(1)
 			c.ResetMock()
+			c.Refresh()
 			c.MockMethodCall(&dbus.Call{Body: newServer(ver)})
 			c.MockMethodCall(&dbus.Call{Body: []interface{}{rv}})
 			n := new(freedesktop.Notification)
@@ -190,6 +598,7 @@ func TestNotify(t *testing.T) {
 		}
 		// spec version error
 		c.ResetMock()
+		c.Refresh()
 		c.MockMethodCall(&dbus.Call{Body: newServer("major.minor")})
 		n := new(freedesktop.Notification)
 		if err := n.Hint(tt.name, tt.value); err != nil {
@@ -200,6 +609,7 @@ func TestNotify(t *testing.T) {
 		}
 		// server error
 		c.ResetMock()
+		c.Refresh()
 		c.MockMethodCall(&dbus.Call{Err: dbus.ErrMsgUnknownMethod})
 		n = new(freedesktop.Notification)
 		if err := n.Hint(tt.name, tt.value); err != nil {
@@ -219,6 +629,170 @@ func TestNotify(t *testing.T) {
 	}
 }
 
+func TestReplace(t *testing.T) {
+	c, err := freedesktop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for _, tt := range []struct {
+		id, rv   uint32
+		replaced bool
+	}{
+		{0, 1, false},
+		{1, 1, true},
+		{1, 2, false},
+	} {
+		c.ResetMock()
+		c.MockMethodCall(&dbus.Call{Body: []interface{}{tt.rv}})
+		n := &freedesktop.Notification{ID: tt.id}
+		id, replaced, err := c.Replace(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, e := c.MethodCall(0).Args[1], tt.id; g != e {
+			t.Errorf("replaces_id = %v, expected %v", g, e)
+		}
+		if g, e := id, tt.rv; g != e {
+			t.Errorf("Replace: id = %v, expected %v", g, e)
+		}
+		if g, e := replaced, tt.replaced; g != e {
+			t.Errorf("Replace: replaced = %v, expected %v", g, e)
+		}
+	}
+
+	// error
+	c.ResetMock()
+	c.MockMethodCall(&dbus.Call{Err: dbus.ErrMsgUnknownMethod})
+	n := &freedesktop.Notification{ID: 1}
+	if _, replaced, err := c.Replace(n); err == nil {
+		t.Fatal("expected error")
+	} else if replaced {
+		t.Error("expected false")
+	}
+}
+
+func TestProgress(t *testing.T) {
+	c, err := freedesktop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var id uint32
+	for _, percent := range []int{0, 50, 100} {
+		c.ResetMock()
+		c.Refresh()
+		c.MockMethodCall(&dbus.Call{Body: newServer("1.2")})
+		c.MockMethodCall(&dbus.Call{Body: []interface{}{uint32(1)}})
+		rv, err := c.Progress(id, "Summary", percent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		call := c.MethodCall(1)
+		if g, e := call.Args[1], id; g != e {
+			t.Errorf("replaces_id = %v, expected %v", g, e)
+		}
+		if g, e := call.Args[3], "Summary"; g != e {
+			t.Errorf("summary = %v, expected %v", g, e)
+		}
+		hints := call.Args[6].(map[string]dbus.Variant)
+		if g, e := hints["value"], dbus.MakeVariant(int32(percent)); !reflect.DeepEqual(g, e) {
+			t.Errorf("value = %v, expected %v", g, e)
+		}
+		if g, e := rv, uint32(1); g != e {
+			t.Errorf("Progress: id = %v, expected %v", g, e)
+		}
+		id = rv
+	}
+	// carry over hints
+	c.ResetMock()
+	c.MockMethodCall(&dbus.Call{Body: []interface{}{uint32(2)}})
+	n := &freedesktop.Notification{Summary: "Summary"}
+	n.Hint("transient", true)
+	n.Hint("resident", true)
+	n.Hint("urgency", 0)
+	if id, err = c.Notify(n); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []map[string]dbus.Variant{
+		{
+			"transient": dbus.MakeVariant(true),
+			"resident":  dbus.MakeVariant(true),
+			"value":     dbus.MakeVariant(int32(50)),
+		},
+		{
+			"value": dbus.MakeVariant(int32(100)),
+		},
+	} {
+		c.ResetMock()
+		c.MockMethodCall(&dbus.Call{Body: []interface{}{id}})
+		if _, err := c.Progress(id, "Summary", int(e["value"].Value().(int32))); err != nil {
+			t.Fatal(err)
+		}
+		if g := c.MethodCall(0).Args[6].(map[string]dbus.Variant); !reflect.DeepEqual(g, e) {
+			t.Errorf("expected %v, got %v", e, g)
+		}
+		// closed
+		c.ResetMock()
+		c.MockMethodCall(&dbus.Call{})
+		if err := c.CloseNotification(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// out of range
+	for _, percent := range []int{-1, 101} {
+		c.ResetMock()
+		if _, err := c.Progress(id, "Summary", percent); err == nil {
+			t.Error("expected error")
+		}
+		if g, e := c.NumMethodCalls(), 0; g != e {
+			t.Errorf("object calls %v times, expected %v", g, e)
+		}
+	}
+	// error
+	c.ResetMock()
+	c.MockMethodCall(&dbus.Call{Err: dbus.ErrMsgUnknownMethod})
+	if _, err := c.Progress(id, "Summary", 0); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestParseSpecVersion(t *testing.T) {
+	for _, tt := range []struct {
+		v            string
+		major, minor int
+	}{
+		{"1", 1, 0},
+		{"1.2", 1, 2},
+		{"1.2.1", 1, 2},
+		{"1.2-beta", 1, 2},
+		{"1.x", 1, 0},
+		{"1.", 1, 0},
+		{" 1.1 ", 1, 1},
+	} {
+		major, minor, err := freedesktop.ParseSpecVersion(tt.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if major != tt.major || minor != tt.minor {
+			t.Errorf("parseSpecVersion(%q) = %v.%v, expected %v.%v", tt.v, major, minor, tt.major, tt.minor)
+		}
+	}
+	// error
+	for _, v := range []string{
+		"",
+		"major.minor",
+		".1",
+	} {
+		if _, _, err := freedesktop.ParseSpecVersion(v); err == nil {
+			t.Errorf("%q: expected error", v)
+		}
+	}
+}
+
 func newServer(ver string) []interface{} {
 	return []interface{}{"go.notify", "", "0.0", ver}
 }
@@ -247,6 +821,167 @@ func TestNotificationClosed(t *testing.T) {
 	}
 }
 
+func TestIsActive(t *testing.T) {
+	c, err := freedesktop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if c.IsActive(1) {
+		t.Error("expected false")
+	}
+	c.MockMethodCall(&dbus.Call{Body: []interface{}{uint32(1)}})
+	if _, err := c.Notify(new(freedesktop.Notification)); err != nil {
+		t.Fatal(err)
+	}
+	if !c.IsActive(1) {
+		t.Error("expected true")
+	}
+	if c.IsActive(2) {
+		t.Error("expected false")
+	}
+	c.MockSignal(&dbus.Signal{
+		Name: "NotificationClosed",
+		Body: []interface{}{uint32(1), uint32(freedesktop.ReasonDismissed)},
+	})
+	<-c.NotificationClosed
+	if c.IsActive(1) {
+		t.Error("expected false")
+	}
+}
+
+func TestIsActiveSender(t *testing.T) {
+	c, err := freedesktop.NewSender()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// bounded
+	n := uint32(freedesktop.MaxActive + 10)
+	for id := uint32(1); id <= n; id++ {
+		c.MockMethodCall(&dbus.Call{Body: []interface{}{id}})
+		if _, err := c.Notify(new(freedesktop.Notification)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for id := uint32(1); id <= n; id++ {
+		if g, e := c.IsActive(id), id > n-freedesktop.MaxActive; g != e {
+			t.Errorf("IsActive(%v) = %v, expected %v", id, g, e)
+		}
+	}
+	// replaced with a new id
+	c.MockMethodCall(&dbus.Call{Body: []interface{}{n + 1}})
+	if _, err := c.Notify(&freedesktop.Notification{ID: n}); err != nil {
+		t.Fatal(err)
+	}
+	if c.IsActive(n) {
+		t.Errorf("IsActive(%v) = true, expected false", n)
+	}
+	if !c.IsActive(n + 1) {
+		t.Errorf("IsActive(%v) = false, expected true", n+1)
+	}
+	// closed
+	c.MockMethodCall(new(dbus.Call))
+	if err := c.CloseNotification(n + 1); err != nil {
+		t.Fatal(err)
+	}
+	if c.IsActive(n + 1) {
+		t.Errorf("IsActive(%v) = true, expected false", n+1)
+	}
+}
+
+func TestNotifyAndAwaitClose(t *testing.T) {
+	c, err := freedesktop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	type result struct {
+		reason freedesktop.Reason
+		err    error
+	}
+	await := func(ctx context.Context, id uint32) <-chan result {
+		c.MockMethodCall(&dbus.Call{Body: []interface{}{id}})
+		ch := make(chan result, 1)
+		go func() {
+			r, err := c.NotifyAndAwaitClose(ctx, new(freedesktop.Notification))
+			ch <- result{r, err}
+		}()
+		for c.NumCloseWaiters() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		return ch
+	}
+
+	ch := await(context.Background(), 1)
+	// other notification
+	c.MockSignal(&dbus.Signal{
+		Name: "NotificationClosed",
+		Body: []interface{}{uint32(2), uint32(freedesktop.ReasonExpired)},
+	})
+	c.MockSignal(&dbus.Signal{
+		Name: "NotificationClosed",
+		Body: []interface{}{uint32(1), uint32(freedesktop.ReasonDismissed)},
+	})
+	if g, e := <-ch, (result{freedesktop.ReasonDismissed, nil}); g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	for _, id := range []uint32{2, 1} {
+		if g := <-c.NotificationClosed; g.ID != id {
+			t.Errorf("<- Client.NotificationClosed = %v, expected %v", g.ID, id)
+		}
+	}
+	if g, e := c.NumCloseWaiters(), 0; g != e {
+		t.Errorf("expected %v waiters, got %v", e, g)
+	}
+	// signal before the reply
+	c.MockMethodCallHook(&dbus.Call{Body: []interface{}{uint32(4)}}, func() {
+		c.MockSignal(&dbus.Signal{
+			Name: "NotificationClosed",
+			Body: []interface{}{uint32(4), uint32(freedesktop.ReasonExpired)},
+		})
+		<-c.NotificationClosed
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	r, err := c.NotifyAndAwaitClose(ctx, new(freedesktop.Notification))
+	cancel()
+	if err != nil {
+		t.Fatal(err)
+	} else if g, e := r, freedesktop.ReasonExpired; g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if c.IsActive(4) {
+		t.Error("expected inactive")
+	}
+	// cancel
+	ctx, cancel = context.WithCancel(context.Background())
+	ch = await(ctx, 3)
+	cancel()
+	if g := <-ch; g.err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", g.err)
+	}
+	if g, e := c.NumCloseWaiters(), 0; g != e {
+		t.Errorf("expected %v waiters, got %v", e, g)
+	}
+	// error
+	c.MockMethodCall(&dbus.Call{Err: dbus.ErrMsgUnknownMethod})
+	if _, err := c.NotifyAndAwaitClose(context.Background(), new(freedesktop.Notification)); err == nil {
+		t.Error("expected error")
+	}
+
+	s, err := freedesktop.NewSender()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.NotifyAndAwaitClose(context.Background(), new(freedesktop.Notification)); err != freedesktop.ErrSender {
+		t.Errorf("expected ErrSender, got %v", err)
+	}
+}
+
 func TestReason(t *testing.T) {
 	for i, tt := range []struct {
 		s string
@@ -287,6 +1022,39 @@ func TestActionInvoked(t *testing.T) {
 	}
 }
 
+func TestReplyReceived(t *testing.T) {
+	c, err := freedesktop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for i := uint32(1); i < 5; i++ {
+		c.MockSignal(&dbus.Signal{
+			Name: "NotificationReplied",
+			Body: []interface{}{i, fmt.Sprint("reply ", i)},
+		})
+	}
+	for i := uint32(1); i < 5; i++ {
+		e := freedesktop.ReplyReceived{
+			ID:   i,
+			Text: fmt.Sprint("reply ", i),
+		}
+		if g := <-c.ReplyReceived; !reflect.DeepEqual(g, e) {
+			t.Errorf("<- Client.ReplyReceived = %v, expected %v", g, e)
+		}
+	}
+}
+
+func TestInlineReply(t *testing.T) {
+	var n freedesktop.Notification
+	n.Action("default", "Default")
+	n.InlineReply("Reply")
+	if g, e := n.Actions, []string{"default", "Default", freedesktop.InlineReplyKey, "Reply"}; !reflect.DeepEqual(g, e) {
+		t.Errorf("Notification.Actions = %v, expected %v", g, e)
+	}
+}
+
 func TestAction(t *testing.T) {
 	var n freedesktop.Notification
 
@@ -303,6 +1071,85 @@ func TestAction(t *testing.T) {
 	}
 }
 
+func TestSetIcon(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 48, 48))
+	data, err := freedesktop.NewImageData(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		icon  interface{}
+		e     string
+		hints map[string]interface{}
+	}{
+		{nil, "", nil},
+		{"path", "path", nil},
+		{img, "", map[string]interface{}{"image-data": data}},
+	} {
+		var n freedesktop.Notification
+		if err := n.SetIcon(tt.icon); err != nil {
+			t.Fatal(err)
+		}
+		if g, e := n.Icon, tt.e; g != e {
+			t.Errorf("Notification.Icon = %q, expected %q", g, e)
+		}
+		if g, e := n.Hints, tt.hints; !reflect.DeepEqual(g, e) {
+			t.Errorf("Notification.Hints = %v, expected %v", g, e)
+		}
+	}
+	// error
+	for _, icon := range []interface{}{
+		image.NewAlpha(image.Rect(0, 0, 48, 48)),
+		0,
+	} {
+		var n freedesktop.Notification
+		if err := n.SetIcon(icon); err == nil {
+			t.Error("expected error")
+		}
+	}
+}
+
+func TestHintVariant(t *testing.T) {
+	c, err := freedesktop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	n := new(freedesktop.Notification)
+	n.HintVariant("x-vendor-int", dbus.MakeVariant(uint16(1)))
+	n.SetDunstStackTag("tag")
+	n.SetKDEDisplayAppName("App")
+	n.SetKDEOriginName("Origin")
+	n.SetKDEURLs("file:///a", "file:///b")
+	c.MockMethodCall(&dbus.Call{Body: newServer("1.2")})
+	c.MockMethodCall(&dbus.Call{Body: []interface{}{uint32(1)}})
+	if _, err := c.Notify(n); err != nil {
+		t.Fatal(err)
+	}
+	hints := c.MethodCall(1).Args[6].(map[string]dbus.Variant)
+	for _, tt := range []struct {
+		name, sig string
+		value     interface{}
+	}{
+		{"x-vendor-int", "q", uint16(1)},
+		{"x-dunst-stack-tag", "s", "tag"},
+		{"x-kde-display-appname", "s", "App"},
+		{"x-kde-origin-name", "s", "Origin"},
+		{"x-kde-urls", "as", []string{"file:///a", "file:///b"}},
+	} {
+		v, ok := hints[tt.name]
+		switch {
+		case !ok:
+			t.Errorf("%v: not found", tt.name)
+		case v.Signature().String() != tt.sig:
+			t.Errorf("%v: signature = %v, expected %v", tt.name, v.Signature(), tt.sig)
+		case !reflect.DeepEqual(v.Value(), tt.value):
+			t.Errorf("%v: value = %v, expected %v", tt.name, v.Value(), tt.value)
+		}
+	}
+}
+
 func TestHint_ImageData(t *testing.T) {
 	for _, v := range []reflect.Value{
 		reflect.ValueOf(image.NewGray),
@@ -349,6 +1196,85 @@ func TestHint_ImageData(t *testing.T) {
 	}
 }
 
+func TestImageDataValidate(t *testing.T) {
+	data := &freedesktop.ImageData{
+		Width:         2,
+		Height:        2,
+		Stride:        8,
+		Alpha:         true,
+		BitsPerSample: 8,
+		NumChannels:   4,
+		Data:          make([]byte, 16),
+	}
+	if err := data.Validate(); err != nil {
+		t.Error(err)
+	}
+	n := new(freedesktop.Notification)
+	if err := n.Hint("image-data", data); err != nil {
+		t.Error(err)
+	}
+
+	for _, tt := range []func(*freedesktop.ImageData){
+		func(d *freedesktop.ImageData) { d.Width = -1 },
+		func(d *freedesktop.ImageData) { d.Height = -1 },
+		func(d *freedesktop.ImageData) { d.NumChannels = 0 },
+		func(d *freedesktop.ImageData) { d.BitsPerSample = 0 },
+		func(d *freedesktop.ImageData) { d.BitsPerSample = 4 },
+		func(d *freedesktop.ImageData) { d.Stride = 7 },
+		func(d *freedesktop.ImageData) { d.Width = 3 },
+		func(d *freedesktop.ImageData) { d.BitsPerSample = 16 },
+		func(d *freedesktop.ImageData) { d.Data = d.Data[:15] },
+		func(d *freedesktop.ImageData) { d.Height = 3 },
+	} {
+		d := *data
+		tt(&d)
+		if err := d.Validate(); !errors.Is(err, freedesktop.ErrImageData) {
+			t.Errorf("expected ErrImageData, got %#v", err)
+		}
+		n := new(freedesktop.Notification)
+		if err := n.Hint("image-data", d); !errors.Is(err, freedesktop.ErrImageData) {
+			t.Errorf("expected ErrImageData, got %#v", err)
+		}
+		if err := n.Hint("image-data", &d); !errors.Is(err, freedesktop.ErrImageData) {
+			t.Errorf("expected ErrImageData, got %#v", err)
+		}
+	}
+	// the last row is not padded
+	d := *data
+	d.Stride = 12
+	d.Data = make([]byte, 12+8)
+	if err := d.Validate(); err != nil {
+		t.Error(err)
+	}
+	d.Data = d.Data[:19]
+	if err := d.Validate(); !errors.Is(err, freedesktop.ErrImageData) {
+		t.Errorf("expected ErrImageData, got %#v", err)
+	}
+}
+
+func TestNewImageDataSubImage(t *testing.T) {
+	r := image.Rect(2, 2, 4, 4)
+	for _, img := range []interface {
+		SubImage(image.Rectangle) image.Image
+	}{
+		image.NewNRGBA(image.Rect(0, 0, 4, 4)),
+		image.NewGray(image.Rect(0, 0, 4, 4)),
+	} {
+		sub := img.SubImage(r)
+		data, err := freedesktop.NewImageData(sub)
+		if err != nil {
+			t.Fatalf("%T: %v", sub, err)
+		}
+		if g, e := [2]int32{data.Width, data.Height}, [2]int32{2, 2}; g != e {
+			t.Errorf("%T: expected %v, got %v", sub, e, g)
+		}
+		n := new(freedesktop.Notification)
+		if err := n.SetIcon(sub); err != nil {
+			t.Errorf("%T: %v", sub, err)
+		}
+	}
+}
+
 func TestHint_ImagePath(t *testing.T) {
 	e := map[string]interface{}{
 		"image-path": "path",
@@ -371,6 +1297,10 @@ func TestHint_ImagePath(t *testing.T) {
 	}
 }
 
+func TestHint_Value(t *testing.T) {
+	testHint_i(t, "value")
+}
+
 func TestHint_X(t *testing.T) {
 	testHint_i(t, "x")
 }
@@ -419,6 +1349,43 @@ func testHint_i(t *testing.T, name string) {
 	}
 }
 
+func TestHint_Category(t *testing.T) {
+	for _, tt := range []struct {
+		v interface{}
+		e string
+	}{
+		{freedesktop.CategoryEmailArrived, "email.arrived"},
+		{freedesktop.Category("x-vendor.sync"), "x-vendor.sync"},
+		{"im.received", "im.received"},
+	} {
+		var n freedesktop.Notification
+		if err := n.Hint("category", tt.v); err != nil {
+			t.Fatal(err)
+		}
+		if g, e := n.Hints, map[string]interface{}{"category": tt.e}; !reflect.DeepEqual(g, e) {
+			t.Errorf("Notification.Hints = %v, expected %v", g, e)
+		}
+	}
+
+	var n freedesktop.Notification
+	if err := n.SetCategory(freedesktop.CategoryDeviceAdded); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := n.Hints["category"], "device.added"; g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if err := n.SetCategory("x-vendor.custom"); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := n.Hints["category"], "x-vendor.custom"; g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	// error
+	if err := n.Hint("category", 1); err == nil {
+		t.Error("expected error")
+	}
+}
+
 func TestHint_Urgency(t *testing.T) {
 	e := map[string]interface{}{
 		"urgency": uint8(1),
@@ -0,0 +1,150 @@
+//
+// go.notify/freedesktop :: theme.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package freedesktop
+
+import (
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// IconTheme resolves an icon name to the ImageData by looking up the icon
+// theme on disk. It is useful for servers which do not support icon themes.
+//
+// See https://specifications.freedesktop.org/icon-theme-spec/ for details.
+type IconTheme struct {
+	Name string   // Theme name; "hicolor" is always looked up as a fallback
+	Size int      // Preferred icon size
+	Dirs []string // Base directories; see DefaultIconDirs
+
+	mu    sync.Mutex
+	cache map[string]*ImageData
+}
+
+// Resolve returns the ImageData of the named icon. Its results are cached
+// including failures.
+func (t *IconTheme) Resolve(name string) (*ImageData, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	data, ok := t.cache[name]
+	if !ok {
+		data = t.lookup(name)
+		if t.cache == nil {
+			t.cache = make(map[string]*ImageData)
+		}
+		t.cache[name] = data
+	}
+	if data == nil {
+		return nil, fmt.Errorf("icon not found: %q", name)
+	}
+	return data, nil
+}
+
+func (t *IconTheme) lookup(name string) *ImageData {
+	if name == "" || strings.ContainsAny(name, `/\:`) {
+		return nil
+	}
+	dirs := t.Dirs
+	if dirs == nil {
+		dirs = DefaultIconDirs()
+	}
+	var themes []string
+	if t.Name != "" && t.Name != "hicolor" {
+		themes = append(themes, t.Name)
+	}
+	themes = append(themes, "hicolor")
+	for _, theme := range themes {
+		var best string
+		var dist int
+		for _, base := range dirs {
+			// <base>/<theme>/<size>/<context>/<name>.png or
+			// <base>/<theme>/<context>/<size>/<name>.png
+			root := filepath.Join(base, theme)
+			list, _ := filepath.Glob(filepath.Join(root, "*", "*", name+".png"))
+			for _, p := range list {
+				if d := t.distance(p[len(root)+1:]); best == "" || d < dist {
+					best = p
+					dist = d
+				}
+			}
+		}
+		if best != "" {
+			if data := loadPNG(best); data != nil {
+				return data
+			}
+		}
+	}
+	for _, base := range dirs {
+		if data := loadPNG(filepath.Join(base, name+".png")); data != nil {
+			return data
+		}
+	}
+	return nil
+}
+
+func (t *IconTheme) distance(p string) int {
+	for _, s := range strings.Split(filepath.ToSlash(filepath.Dir(p)), "/") {
+		if i := strings.IndexByte(s, 'x'); i != -1 {
+			s = s[:i]
+		}
+		if size, err := strconv.Atoi(s); err == nil {
+			if size < t.Size {
+				return t.Size - size
+			}
+			return size - t.Size
+		}
+	}
+	return 1 << 16
+}
+
+func loadPNG(name string) *ImageData {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil
+	}
+	data, err := NewImageData(img)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// DefaultIconDirs returns the base directories of icon themes.
+func DefaultIconDirs() []string {
+	var dirs []string
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".icons"))
+	}
+	if s := os.Getenv("XDG_DATA_HOME"); s != "" {
+		dirs = append(dirs, filepath.Join(s, "icons"))
+	} else if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".local", "share", "icons"))
+	}
+	s := os.Getenv("XDG_DATA_DIRS")
+	if s == "" {
+		s = "/usr/local/share:/usr/share"
+	}
+	for _, s := range filepath.SplitList(s) {
+		if s != "" {
+			dirs = append(dirs, filepath.Join(s, "icons"))
+		}
+	}
+	return append(dirs, "/usr/share/pixmaps")
+}
@@ -0,0 +1,130 @@
+//
+// go.notify/freedesktop :: theme_test.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package freedesktop_test
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/hattya/go.notify/freedesktop"
+)
+
+func TestIconTheme(t *testing.T) {
+	dir := t.TempDir()
+	for _, size := range []int{16, 48} {
+		if err := mkicon(filepath.Join(dir, "hicolor", fmt.Sprintf("%[1]vx%[1]v", size), "apps"), "go.notify", size); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mkicon(filepath.Join(dir, "theme", "apps", "32"), "go.notify-theme", 32); err != nil {
+		t.Fatal(err)
+	}
+	if err := mkicon(dir, "go.notify-pixmap", 24); err != nil {
+		t.Fatal(err)
+	}
+
+	theme := &freedesktop.IconTheme{
+		Name: "theme",
+		Size: 48,
+		Dirs: []string{dir},
+	}
+	for _, tt := range []struct {
+		name string
+		size int32
+	}{
+		{"go.notify", 48},
+		{"go.notify-theme", 32},
+		{"go.notify-pixmap", 24},
+	} {
+		switch data, err := theme.Resolve(tt.name); {
+		case err != nil:
+			t.Error(err)
+		case data.Width != tt.size:
+			t.Errorf("%v: width = %v, expected %v", tt.name, data.Width, tt.size)
+		}
+	}
+	theme.Size = 16
+	// cached
+	if err := os.RemoveAll(filepath.Join(dir, "hicolor")); err != nil {
+		t.Fatal(err)
+	}
+	switch data, err := theme.Resolve("go.notify"); {
+	case err != nil:
+		t.Error(err)
+	case data.Width != 48:
+		t.Errorf("width = %v, expected %v", data.Width, 48)
+	}
+	// error
+	for _, name := range []string{
+		"",
+		"unknown",
+		filepath.Join(dir, "go.notify-pixmap"),
+	} {
+		if _, err := theme.Resolve(name); err == nil {
+			t.Errorf("%q: expected error", name)
+		}
+	}
+}
+
+func mkicon(dir, name string, size int) error {
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return err
+	}
+	f, err := os.Create(filepath.Join(dir, name+".png"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return png.Encode(f, image.NewNRGBA(image.Rect(0, 0, size, size)))
+}
+
+func TestNotify_IconTheme(t *testing.T) {
+	c, err := freedesktop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	dir := t.TempDir()
+	if err := mkicon(dir, "go.notify", 48); err != nil {
+		t.Fatal(err)
+	}
+	c.IconTheme = &freedesktop.IconTheme{Dirs: []string{dir}}
+
+	c.ResetMock()
+	c.MockMethodCall(&dbus.Call{Body: newServer("1.2")})
+	c.MockMethodCall(&dbus.Call{Body: []interface{}{uint32(1)}})
+	if _, err := c.Notify(&freedesktop.Notification{Icon: "go.notify"}); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := c.NumMethodCalls(), 2; g != e {
+		t.Errorf("object calls %v times, expected %v", g, e)
+	}
+	hints := c.MethodCall(1).Args[6].(map[string]dbus.Variant)
+	if _, ok := hints["image-data"]; !ok {
+		t.Error("image-data is not set")
+	}
+	// unresolved
+	c.ResetMock()
+	c.MockMethodCall(&dbus.Call{Body: []interface{}{uint32(1)}})
+	if _, err := c.Notify(&freedesktop.Notification{Icon: "unknown"}); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := c.NumMethodCalls(), 1; g != e {
+		t.Errorf("object calls %v times, expected %v", g, e)
+	}
+	if g, e := c.MethodCall(0).Args[2], "unknown"; g != e {
+		t.Errorf("icon = %v, expected %v", g, e)
+	}
+}
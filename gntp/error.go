@@ -1,14 +1,17 @@
 //
 // go.notify/gntp :: error.go
 //
-//   Copyright (c) 2017-2019 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2017-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
 
 package gntp
 
-import "net/textproto"
+import (
+	"fmt"
+	"net/textproto"
+)
 
 // ErrorCode represents an Error-Code value.
 type ErrorCode int
@@ -29,10 +32,13 @@ const (
 	InternalServerError    ErrorCode = 500
 )
 
-// Description returns an Error-Description of the Error-Code. It returns the
-// empty string if the code is unknown.
+// Description returns an Error-Description of the Error-Code. It returns a
+// generic description which contains the code if the code is unknown.
 func (code ErrorCode) Description() string {
-	return errorDescription[code]
+	if s, ok := errorDescription[code]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown Error (%d)", int(code))
 }
 
 var errorDescription = map[ErrorCode]string{
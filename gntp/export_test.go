@@ -1,19 +1,22 @@
 //
 // go.notify/gntp :: export_test.go
 //
-//   Copyright (c) 2017-2019 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2017-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
 
 package gntp
 
-import "crypto/cipher"
+import (
+	"context"
+	"crypto/cipher"
+)
 
 var RFC3339 = rfc3339
 
 func (c *Client) Send(mt string) (resp *Response, err error) {
-	return c.send(mt, c.buffer())
+	return c.send(context.Background(), mt, c.buffer(), nil)
 }
 
 func (c *Client) Wait() {
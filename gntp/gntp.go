@@ -1,7 +1,7 @@
 //
 // go.notify/gntp :: gntp.go
 //
-//   Copyright (c) 2017-2022 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2017-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -26,6 +26,8 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -33,28 +35,59 @@ import (
 	"image"
 	"image/png"
 	"io"
+	"io/fs"
+	"mime"
 	"net"
 	"net/textproto"
+	"net/url"
+	"os"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/hattya/go.notify/internal/util"
 )
 
 var (
-	ErrProtocol   = errors.New("notify: protocol error")
-	ErrHash       = errors.New("notify: unknown hash algorithm")
-	ErrEncryption = errors.New("notify: unknown encryption algorithm")
-	ErrKeyLength  = errors.New("notify: key length is too short")
-	ErrPassword   = errors.New("notify: incorrect password")
-	ErrPKCS7      = errors.New("notify: invalid PKCS #7 padding")
+	ErrProtocol       = errors.New("notify: protocol error")
+	ErrHash           = errors.New("notify: unknown hash algorithm")
+	ErrEncryption     = errors.New("notify: unknown encryption algorithm")
+	ErrKeyLength      = errors.New("notify: key length is too short")
+	ErrPassword       = errors.New("notify: incorrect password")
+	ErrPKCS7          = errors.New("notify: invalid PKCS #7 padding")
+	ErrResponseSize   = errors.New("notify: response exceeds MaxResponseSize")
+	ErrCallbackTarget = errors.New("notify: callback target must be an http or https URL")
+	ErrNetwork        = errors.New("notify: unsupported network")
+	ErrTextSize       = errors.New("notify: text exceeds the size limit")
+	ErrCertificate    = errors.New("notify: server certificate is not pinned")
+	ErrName           = errors.New("notify: notification name is empty")
+	ErrPriority       = errors.New("notify: priority must be in the range -2 to 2")
+	ErrContextType    = errors.New("notify: callback context type is empty")
+	ErrLimit          = errors.New("notify: request exceeds the limit")
+	ErrSession        = errors.New("notify: socket callback is not available in a session")
 )
 
 const rfc3339 = "2006-01-02 15:04:05Z"
 
+const (
+	// DefaultServer is the host name of the default server.
+	DefaultServer = "localhost"
+	// DefaultPort is the well-known port number of GNTP.
+	DefaultPort = 23053
+	// ResourceScheme is the scheme of the URLs which refer to the binary
+	// resources sent along with the request.
+	ResourceScheme = "x-growl-resource://"
+)
+
+// Localhost returns the address of the default server which is used by New.
+func Localhost() string {
+	return net.JoinHostPort(DefaultServer, strconv.Itoa(DefaultPort))
+}
+
 // Client is a GNTP client.
 type Client struct {
 	Server              string
@@ -64,23 +97,114 @@ type Client struct {
 	HashAlgorithm       HashAlgorithm
 	EncryptionAlgorithm EncryptionAlgorithm
 
+	// Origin is written as the Origin-* headers of each request. The
+	// MachineName is filled from the host name of the local machine if it
+	// is empty, unless NoHostname is true. The Origin-Machine-Name header
+	// is omitted if the host name cannot be determined.
+	Origin     Origin
+	NoHostname bool
+
 	// Custom Headers and App-Specific Headers
+	//
+	// They are written in the header section of each request, so they are
+	// encrypted along with the other headers if EncryptionAlgorithm is not
+	// NONE. The values of []byte and io.Reader are sent as the binary
+	// resources, which are also encrypted unless the ResourceStore is used.
 	Header map[string]interface{}
 
+	// HeaderEncoding specifies how to encode the header values which contain
+	// non-ASCII characters for strict servers. They are written as raw UTF-8
+	// by default.
+	HeaderEncoding HeaderEncoding
+
+	// AcceptEncoding is a list of the content codings such as "gzip" which
+	// the Client accepts for the binary resources. It is advertised by the
+	// X-Accept-Encoding header if it is not empty, and the coding which the
+	// server chooses is reported as the ContentEncoding of the Response.
+	//
+	// This is an experimental extension of the GNTP protocol, and the
+	// resources are not decoded by the Client.
+	AcceptEncoding []string
+
+	// TLSConfig specifies the TLS configuration to use for connections to
+	// the server. TLS is not used if it is nil. The server certificate is
+	// verified against the host portion of the Server field unless
+	// ServerName or InsecureSkipVerify is set explicitly.
+	TLSConfig *tls.Config
+
+	// PinnedCertificates is a list of the SHA-256 fingerprints of the
+	// server certificates to accept. If it is not empty, TLS is used even
+	// if TLSConfig is nil, and the server certificate is accepted only if
+	// its fingerprint is in the list instead of the verification by the
+	// certificate authorities. ErrCertificate is returned otherwise.
+	PinnedCertificates [][sha256.Size]byte
+
+	// MaxResponseSize limits the number of bytes to read for a response
+	// and for a socket callback respectively if it is greater than 0.
+	MaxResponseSize int64
+
+	// MaxNotifications and MaxResources limit the number of notifications
+	// and binary resources in a REGISTER request respectively if they are
+	// greater than 0. ErrLimit is returned before sending the request if
+	// they are exceeded. The limits depend on the server, which rejects an
+	// over-large request as an InvalidRequest error.
+	MaxNotifications int
+	MaxResources     int
+
+	// CallbackTimeout limits the time to wait for a socket callback if it
+	// is greater than 0. The connection is closed when it is exceeded.
+	CallbackTimeout time.Duration
+
+	// Now returns the current time which is used for the deadline of the
+	// CallbackTimeout. It defaults to time.Now. If it is not nil, it is also
+	// used to stamp the Callback whose Notification-Callback-Timestamp header
+	// is missing or invalid, otherwise the Timestamp of such a Callback is
+	// zero.
+	Now func() time.Time
+
+	// PNGEncoder is used to encode the image.Image icons if it is not nil.
+	PNGEncoder *png.Encoder
+
+	// ResourceStore is used to host the binary resources if it is not nil.
+	// The URLs returned by it are sent instead of embedding the resources.
+	//
+	// The resources are not encrypted even if EncryptionAlgorithm is not
+	// NONE, since the server fetches them from the URLs. Therefore it should
+	// not be used for confidential resources unless the ResourceStore
+	// protects them by itself.
+	ResourceStore ResourceStore
+
+	// Network specifies the network to connect to the server, "tcp" or
+	// "udp". It defaults to "tcp" if it is empty.
+	//
+	// The "udp" network is experimental and intended for relays which
+	// accept fire-and-forget notifications. A request is written as a
+	// single datagram, and no response is read. Therefore Register and
+	// Notify return a nil *Response, and socket callbacks are not
+	// available. It cannot be used with TLSConfig.
+	Network string
+
+	// Dialer is used to connect to the server if it is not nil, so the
+	// options such as Timeout, KeepAlive, and LocalAddr are applied to all
+	// the connections including the ones which wait for socket callbacks.
+	Dialer *net.Dialer
+
 	Callback chan *Callback
-	wg       sync.WaitGroup // for testing
+	wg       sync.WaitGroup
 
 	mu     sync.Mutex
 	cb     map[net.Conn]struct{}
+	last   *Info
 	ctx    context.Context
 	cancel context.CancelFunc
+	closed bool
 }
 
 // New returns a new Client.
 func New() *Client {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Client{
-		Server:   "localhost:23053",
+		Server:   Localhost(),
 		Header:   make(map[string]interface{}),
 		Callback: make(chan *Callback),
 		cb:       make(map[net.Conn]struct{}),
@@ -102,28 +226,96 @@ func (c *Client) Reset() {
 	c.ctx, c.cancel = context.WithCancel(context.Background())
 }
 
+// Close closes connections that are waiting for socket callback, and closes
+// the Callback channel after all of them are finished. Pending callbacks are
+// discarded.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	for conn := range c.cb {
+		conn.Close()
+	}
+	c.cancel()
+	c.mu.Unlock()
+
+	c.wg.Wait()
+	close(c.Callback)
+	return nil
+}
+
+// LastInfo returns a copy of the GNTP information of the last request, or nil
+// if no request has been sent. It can be used for audit logging of the salt
+// and IV, and it does not have the key. Requests which are built by
+// Request.Build are not recorded.
+func (c *Client) LastInfo() *Info {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.last == nil {
+		return nil
+	}
+	return c.last.clone()
+}
+
 // Register sends a REGISTER request to the server.
 //
-// A REGISTER request only uses the Name, DisplayName, Enabled, and Icon
-// fields of the Notification.
+// A REGISTER request only uses the Name, DisplayName, Enabled, Icon, and
+// Header fields of the Notification.
 func (c *Client) Register(n []*Notification) (*Response, error) {
+	return c.RegisterWithOpts(n, nil)
+}
+
+// RegisterOpts represents per-call options for a REGISTER request.
+type RegisterOpts struct {
+	// Icon is used instead of the Icon of the Client if it is not nil.
+	Icon Icon
+
+	// Header is merged with the Header of the Client, and takes precedence
+	// over it.
+	Header map[string]interface{}
+}
+
+// RegisterWithOpts is like Register but uses the specified options. The
+// options are used instead of modifying the Client for each call, so it is
+// safe to call concurrently as long as the Client is not modified.
+func (c *Client) RegisterWithOpts(n []*Notification, opts *RegisterOpts) (*Response, error) {
+	b, err := c.registerBuffer(n, opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(context.Background(), "REGISTER", b, nil)
+}
+
+func (c *Client) registerBuffer(n []*Notification, opts *RegisterOpts) (*buffer, error) {
+	if opts == nil {
+		opts = new(RegisterOpts)
+	}
+	icon := opts.Icon
+	if icon == nil {
+		icon = c.Icon
+	}
+
+	if c.MaxNotifications > 0 && len(n) > c.MaxNotifications {
+		return nil, fmt.Errorf("%w: %v notifications", ErrLimit, len(n))
+	}
+
 	b := c.buffer()
 	b.Header("Application-Name", c.Name)
-	switch icon, err := b.Icon(c.Icon); {
+	switch icon, err := b.Icon(icon); {
 	case err != nil:
 		return nil, err
 	case icon != "":
 		b.Header("Application-Icon", icon)
 	}
 	b.Header("Notifications-Count", len(n))
-	for k, v := range c.Header {
-		switch id, err := b.Resource(v); {
-		case err != nil:
-			return nil, err
-		case id != "":
-			v = id
-		}
-		b.Header(textproto.CanonicalMIMEHeaderKey(k), v)
+	b.Origin()
+	b.AcceptEncoding()
+	if err := b.Headers(c.Header, opts.Header); err != nil {
+		return nil, err
 	}
 	for _, n := range n {
 		b.CRLF()
@@ -140,8 +332,14 @@ func (c *Client) Register(n []*Notification) (*Response, error) {
 		case icon != "":
 			b.Header("Notification-Icon", icon)
 		}
+		if err := b.Headers(n.Header); err != nil {
+			return nil, err
+		}
+	}
+	if c.MaxResources > 0 && len(b.list) > c.MaxResources {
+		return nil, fmt.Errorf("%w: %v resources", ErrLimit, len(b.list))
 	}
-	return c.send("REGISTER", b)
+	return b, nil
 }
 
 // Notify sends a NOTIFY request to the server.
@@ -149,6 +347,56 @@ func (c *Client) Register(n []*Notification) (*Response, error) {
 // A NOTIFY request does not use the DisplayName and Enabled fields of the
 // Notification.
 func (c *Client) Notify(n *Notification) (*Response, error) {
+	return c.NotifyContext(context.Background(), n)
+}
+
+// NotifyContext is like Notify but uses the specified context. The context
+// only bounds the NOTIFY request and not the socket callback.
+func (c *Client) NotifyContext(ctx context.Context, n *Notification) (*Response, error) {
+	return c.NotifyWithOpts(ctx, n, nil)
+}
+
+// NotifyOpts represents per-call options for a NOTIFY request.
+type NotifyOpts struct {
+	// Header is merged with the Header of the Client, and takes precedence
+	// over it. The Header of the Notification takes precedence over this.
+	Header map[string]interface{}
+}
+
+// NotifyWithOpts is like NotifyContext but uses the specified options. The
+// options are used instead of modifying the Client for each call, so it is
+// safe to call concurrently as long as the Client is not modified.
+func (c *Client) NotifyWithOpts(ctx context.Context, n *Notification, opts *NotifyOpts) (*Response, error) {
+	b, err := c.notifyBuffer(n, opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(ctx, "NOTIFY", b, nil)
+}
+
+// NotifyWithCallback is like NotifyContext but returns a channel which
+// receives the socket callback for the Notification instead of the Callback
+// of the Client. The channel is closed when the callback arrives or the
+// connection ends, and it is closed immediately if the request fails.
+func (c *Client) NotifyWithCallback(ctx context.Context, n *Notification) (*Response, <-chan *Callback, error) {
+	ch := make(chan *Callback, 1)
+	b, err := c.notifyBuffer(n, nil)
+	if err != nil {
+		close(ch)
+		return nil, ch, err
+	}
+	resp, err := c.send(ctx, "NOTIFY", b, ch)
+	return resp, ch, err
+}
+
+func (c *Client) notifyBuffer(n *Notification, opts *NotifyOpts) (*buffer, error) {
+	if opts == nil {
+		opts = new(NotifyOpts)
+	}
+	if err := n.Validate(); err != nil {
+		return nil, err
+	}
+
 	b := c.buffer()
 	b.Header("Application-Name", c.Name)
 	b.Header("Notification-Name", n.Name)
@@ -166,7 +414,7 @@ func (c *Client) Notify(n *Notification) (*Response, error) {
 	switch icon, err := b.Icon(n.Icon); {
 	case err != nil:
 		return nil, err
-	case icon != "":
+	case icon != "" || n.Icon == "":
 		b.Header("Notification-Icon", icon)
 	}
 	if n.CoalescingID != "" {
@@ -179,73 +427,249 @@ func (c *Client) Notify(n *Notification) (*Response, error) {
 	if n.CallbackTarget != "" {
 		b.Header("Notification-Callback-Target", n.CallbackTarget)
 	}
-	for k, v := range c.Header {
-		switch id, err := b.Resource(v); {
-		case err != nil:
-			return nil, err
-		case id != "":
-			v = id
-		}
-		b.Header(textproto.CanonicalMIMEHeaderKey(k), v)
+	b.Origin()
+	b.AcceptEncoding()
+	if err := b.Headers(c.Header, opts.Header, n.Header); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Request represents a GNTP request which is built to send later, e.g. when
+// the server becomes reachable.
+type Request struct {
+	c  *Client
+	mt string
+	b  *buffer
+}
+
+// NewRegisterRequest returns a new REGISTER Request. See RegisterWithOpts.
+func (c *Client) NewRegisterRequest(n []*Notification, opts *RegisterOpts) (*Request, error) {
+	b, err := c.registerBuffer(n, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Request{
+		c:  c,
+		mt: "REGISTER",
+		b:  b,
+	}, nil
+}
+
+// NewNotifyRequest returns a new NOTIFY Request. See NotifyWithOpts.
+func (c *Client) NewNotifyRequest(n *Notification, opts *NotifyOpts) (*Request, error) {
+	b, err := c.notifyBuffer(n, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Request{
+		c:  c,
+		mt: "NOTIFY",
+		b:  b,
+	}, nil
+}
+
+// Build returns the serialized Request including the binary resources,
+// which can be sent by SendBytes.
+//
+// The Request is authenticated and encrypted with the Password of the Client
+// at the time of Build, and a new salt and IV are generated for each Build.
+// Therefore the bytes must be rebuilt if the password is changed, and the
+// bytes of the same Request are different each time while the server
+// accepts any of them.
+func (r *Request) Build() ([]byte, error) {
+	i, err := r.c.info(r.mt, r.c.HashAlgorithm, r.c.EncryptionAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	w := new(bytes.Buffer)
+	r.c.write(w, i, r.b)
+	return w.Bytes(), nil
+}
+
+// SendBytes sends the request which is built by Request.Build, and returns
+// the response. The Password of the Client is used to parse the response,
+// and the socket callback of a NOTIFY request is sent to the Callback.
+func (c *Client) SendBytes(b []byte) (*Response, error) {
+	l, _, _ := bytes.Cut(b, []byte("\r\n"))
+	f := strings.Fields(string(l))
+	if len(f) < 2 {
+		return nil, ErrProtocol
 	}
-	return c.send("NOTIFY", b)
+	return c.do(context.Background(), f[1], func(w io.Writer) error {
+		w.Write(b)
+		return nil
+	}, nil)
 }
 
 func (c *Client) buffer() *buffer {
 	return &buffer{
 		c:    c,
-		list: make(map[string][]byte),
+		list: make(map[string]chunks),
 	}
 }
 
-func (c *Client) send(mt string, b *buffer) (resp *Response, err error) {
-	conn, err := net.Dial("tcp", c.Server)
+func (c *Client) send(ctx context.Context, mt string, b *buffer, ch chan *Callback) (*Response, error) {
+	return c.do(ctx, mt, func(w io.Writer) error {
+		return c.encode(w, mt, b)
+	}, ch)
+}
+
+// encode writes the request with a new Info.
+func (c *Client) encode(w io.Writer, mt string, b *buffer) error {
+	return c.encodeWith(w, mt, c.HashAlgorithm, c.EncryptionAlgorithm, b)
+}
+
+// encodeWith is like encode but uses the specified algorithms instead of the
+// ones of the Client.
+func (c *Client) encodeWith(w io.Writer, mt string, ha HashAlgorithm, ea EncryptionAlgorithm, b *buffer) error {
+	i, err := c.info(mt, ha, ea)
 	if err != nil {
-		return
+		return err
 	}
-	defer func() {
-		if err != nil || mt != "NOTIFY" {
-			conn.Close()
-		}
-	}()
+	c.record(i)
+	c.write(w, i, b)
+	return nil
+}
 
+// info returns a new Info which has a new salt and IV.
+func (c *Client) info(mt string, ha HashAlgorithm, ea EncryptionAlgorithm) (*Info, error) {
 	i := &Info{
 		Version:             "1.0",
 		MessageType:         mt,
-		HashAlgorithm:       c.HashAlgorithm,
-		EncryptionAlgorithm: c.EncryptionAlgorithm,
+		HashAlgorithm:       ha,
+		EncryptionAlgorithm: ea,
 	}
-	if err = i.SetPassword(c.Password); err != nil {
-		return
+	if err := i.SetPassword(c.Password); err != nil {
+		return nil, err
 	}
-	io.WriteString(conn, i.String())
-	io.WriteString(conn, "\r\n")
-	if c.EncryptionAlgorithm != NONE {
-		conn.Write(i.Encrypt(b.Bytes()))
-		io.WriteString(conn, "\r\n\r\n")
+	return i, nil
+}
+
+// record records i as the GNTP information of the last request.
+func (c *Client) record(i *Info) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.last = i.clone()
+}
+
+// write writes the request which consists of the GNTP information line, the
+// headers, and the binary resources. Errors of w are ignored since the server
+// may send an error response before reading the whole request.
+func (c *Client) write(w io.Writer, i *Info, b *buffer) {
+	io.WriteString(w, i.String())
+	io.WriteString(w, "\r\n")
+	if i.EncryptionAlgorithm != NONE {
+		w.Write(i.Encrypt(b.Bytes()))
+		io.WriteString(w, "\r\n\r\n")
 	} else {
-		conn.Write(b.Bytes())
-		io.WriteString(conn, "\r\n")
+		w.Write(b.Bytes())
+		io.WriteString(w, "\r\n")
 	}
 	for id, data := range b.list {
-		if c.EncryptionAlgorithm != NONE {
-			data = i.Encrypt(data)
+		if i.EncryptionAlgorithm != NONE {
+			data = chunks{i.Encrypt(data.Bytes())}
 		}
-		fmt.Fprintf(conn, "Identifier: %v\r\n", id)
-		fmt.Fprintf(conn, "Length: %v\r\n\r\n", len(data))
-		conn.Write(data)
-		io.WriteString(conn, "\r\n\r\n")
+		fmt.Fprintf(w, "Identifier: %v\r\n", id)
+		fmt.Fprintf(w, "Length: %v\r\n\r\n", data.Len())
+		for _, p := range data {
+			w.Write(p)
+		}
+		io.WriteString(w, "\r\n\r\n")
+	}
+	io.WriteString(w, "\r\n")
+}
+
+func (c *Client) do(ctx context.Context, mt string, write func(io.Writer) error, ch chan *Callback) (resp *Response, err error) {
+	if ch != nil {
+		// closed unless the socket callback is started
+		defer func() {
+			if ch != nil {
+				close(ch)
+			}
+		}()
+	}
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+	udp := c.Network == "udp"
+	defer func() {
+		stop()
+		if err != nil && ctx.Err() != nil {
+			resp, err = nil, ctx.Err()
+		}
+		if err != nil || mt != "NOTIFY" || udp {
+			conn.Close()
+		}
+	}()
+
+	if udp {
+		w := new(bytes.Buffer)
+		if err = write(w); err == nil {
+			_, err = conn.Write(w.Bytes())
+		}
+		return
+	} else if err = write(conn); err != nil {
+		return
 	}
-	io.WriteString(conn, "\r\n")
 
 	// response
-	br := bufio.NewReader(conn)
+	var lr *limitedReader
+	var rd io.Reader = conn
+	if c.MaxResponseSize > 0 {
+		lr = &limitedReader{r: conn, n: c.MaxResponseSize}
+		rd = lr
+	}
+	br := bufio.NewReader(rd)
+	resp, err = c.response(br)
+	if err == nil && !stop() {
+		// context is done
+		return nil, ctx.Err()
+	}
+	// socket callback
+	if err == nil && mt == "NOTIFY" {
+		if lr != nil {
+			lr.n = c.MaxResponseSize
+		}
+		c.mu.Lock()
+		if c.closed {
+			conn.Close()
+		} else {
+			if c.CallbackTimeout > 0 {
+				conn.SetReadDeadline(c.now().Add(c.CallbackTimeout))
+			}
+			c.cb[conn] = struct{}{}
+			resp.c = c
+			resp.conn = conn
+			c.wg.Add(1)
+			go c.callback(c.ctx, conn, br, ch)
+			ch = nil
+		}
+		c.mu.Unlock()
+	}
+	return
+}
+
+func (c *Client) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+// response reads a response from br.
+func (c *Client) response(br *bufio.Reader) (resp *Response, err error) {
 	r := textproto.NewReader(br)
 	l, err := r.ReadLine()
 	if err != nil {
 		return
 	}
-	i, err = ParseInfo(l, c.Password)
+	i, err := ParseInfo(l, c.Password)
 	if err != nil {
 		return
 	}
@@ -272,12 +696,14 @@ func (c *Client) send(mt string, b *buffer) (resp *Response, err error) {
 			err = nil
 		}
 		resp = &Response{
-			Action: hdr.Get("Response-Action"),
-			ID:     hdr.Get("Notification-ID"),
-			Header: hdr,
+			Action:          hdr.Get("Response-Action"),
+			ID:              hdr.Get("Notification-ID"),
+			ContentEncoding: hdr.Get("X-Content-Encoding"),
+			Header:          hdr,
 		}
 		hdr.Del("Response-Action")
 		hdr.Del("Notification-ID")
+		hdr.Del("X-Content-Encoding")
 	case "-ERROR":
 		if i.EncryptionAlgorithm != NONE {
 			err = ErrProtocol
@@ -292,9 +718,13 @@ func (c *Client) send(mt string, b *buffer) (resp *Response, err error) {
 		if err != nil {
 			break
 		}
+		desc := hdr.Get("Error-Description")
+		if desc == "" {
+			desc = ErrorCode(code).Description()
+		}
 		err = Error{
 			Code:        ErrorCode(code),
-			Description: hdr.Get("Error-Description"),
+			Description: desc,
 			Header:      hdr,
 		}
 		hdr.Del("Error-Code")
@@ -302,19 +732,75 @@ func (c *Client) send(mt string, b *buffer) (resp *Response, err error) {
 	default:
 		err = ErrProtocol
 	}
-	// socket callback
-	if err == nil && mt == "NOTIFY" {
-		c.mu.Lock()
-		c.cb[conn] = struct{}{}
-		c.mu.Unlock()
-		c.wg.Add(1)
-		go c.callback(c.ctx, conn, br)
-	}
 	return
 }
 
-func (c *Client) callback(ctx context.Context, conn net.Conn, br *bufio.Reader) {
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	d := c.Dialer
+	if d == nil {
+		d = new(net.Dialer)
+	}
+	switch c.Network {
+	case "", "tcp":
+	case "udp":
+		if c.TLSConfig != nil || len(c.PinnedCertificates) != 0 {
+			return nil, ErrNetwork
+		}
+		return d.DialContext(ctx, "udp", c.Server)
+	default:
+		return nil, ErrNetwork
+	}
+	cfg := c.TLSConfig
+	switch {
+	case len(c.PinnedCertificates) != 0:
+		if cfg == nil {
+			cfg = new(tls.Config)
+		} else {
+			cfg = cfg.Clone()
+		}
+		verify := cfg.VerifyPeerCertificate
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = func(rawCerts [][]byte, chains [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return ErrCertificate
+			}
+			fp := sha256.Sum256(rawCerts[0])
+			for _, pin := range c.PinnedCertificates {
+				if fp == pin {
+					if verify != nil {
+						return verify(rawCerts, chains)
+					}
+					return nil
+				}
+			}
+			return ErrCertificate
+		}
+	case cfg == nil:
+		return d.DialContext(ctx, "tcp", c.Server)
+	}
+
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(c.Server)
+		if err != nil {
+			return nil, err
+		}
+		if cfg == c.TLSConfig {
+			cfg = cfg.Clone()
+		}
+		cfg.ServerName = host
+	}
+	td := &tls.Dialer{
+		NetDialer: d,
+		Config:    cfg,
+	}
+	return td.DialContext(ctx, "tcp", c.Server)
+}
+
+func (c *Client) callback(ctx context.Context, conn net.Conn, br *bufio.Reader, ch chan<- *Callback) {
 	defer c.wg.Done()
+	if ch != nil {
+		defer close(ch)
+	}
 	defer func() {
 		c.mu.Lock()
 		delete(c.cb, conn)
@@ -376,8 +862,14 @@ func (c *Client) callback(ctx context.Context, conn net.Conn, br *bufio.Reader)
 	cb.Timestamp, err = time.Parse(rfc3339, hdr.Get("Notification-Callback-Timestamp"))
 	if err == nil {
 		hdr.Del("Notification-Callback-Timestamp")
+	} else if c.Now != nil {
+		cb.Timestamp = c.Now()
 	}
 
+	if ch != nil {
+		ch <- cb
+		return
+	}
 	select {
 	case c.Callback <- cb:
 	case <-ctx.Done():
@@ -402,6 +894,17 @@ const (
 	SHA512
 )
 
+// ParseHashAlgorithm returns the HashAlgorithm which is represented by s.
+// It is case-insensitive, and returns ErrHash if s is unknown.
+func ParseHashAlgorithm(s string) (HashAlgorithm, error) {
+	for ha := MD5; ha <= SHA512; ha++ {
+		if strings.EqualFold(s, ha.String()) {
+			return ha, nil
+		}
+	}
+	return -1, ErrHash
+}
+
 // New returns a new hash.Hash.
 func (ha HashAlgorithm) New() (h hash.Hash, err error) {
 	switch ha {
@@ -430,6 +933,21 @@ const (
 	AES
 )
 
+// ParseEncryptionAlgorithm returns the EncryptionAlgorithm which is
+// represented by s. It is case-insensitive, and accepts "TDES" as an alias
+// of "3DES". It returns ErrEncryption if s is unknown.
+func ParseEncryptionAlgorithm(s string) (EncryptionAlgorithm, error) {
+	if strings.EqualFold(s, "TDES") {
+		return TDES, nil
+	}
+	for ea := NONE; ea <= AES; ea++ {
+		if strings.EqualFold(s, ea.String()) {
+			return ea, nil
+		}
+	}
+	return -1, ErrEncryption
+}
+
 // New returns a new cipher.Block.
 func (ea EncryptionAlgorithm) New(key []byte) (cipher.Block, error) {
 	var newCipher func([]byte) (cipher.Block, error)
@@ -469,7 +987,69 @@ func (ea EncryptionAlgorithm) String() string {
 	return fmt.Sprintf("EncryptionAlgorithm(%d)", ea)
 }
 
+// HeaderEncoding represents an encoding of the header values.
+type HeaderEncoding int
+
+// List of encodings for the header values.
+const (
+	RawUTF8         HeaderEncoding = iota
+	RFC2047                        // encoded-word of RFC 2047
+	PercentEncoding                // percent-encoding of UTF-8 bytes
+)
+
+// Encode encodes s with the HeaderEncoding. RFC2047 encodes s only if it
+// contains non-ASCII characters, and PercentEncoding escapes '%' in addition
+// to them.
+func (he HeaderEncoding) Encode(s string) string {
+	switch he {
+	case RFC2047:
+		for i := 0; i < len(s); i++ {
+			if s[i] >= utf8.RuneSelf {
+				return mime.BEncoding.Encode("utf-8", s)
+			}
+		}
+	case PercentEncoding:
+		const hex = "0123456789ABCDEF"
+		var b strings.Builder
+		for i := 0; i < len(s); i++ {
+			if c := s[i]; c < utf8.RuneSelf && c != '%' {
+				b.WriteByte(c)
+			} else {
+				b.WriteByte('%')
+				b.WriteByte(hex[c>>4])
+				b.WriteByte(hex[c&0xf])
+			}
+		}
+		return b.String()
+	}
+	return s
+}
+
+// Origin represents the origin of a request.
+type Origin struct {
+	MachineName     string
+	SoftwareName    string
+	SoftwareVersion string
+	PlatformName    string
+	PlatformVersion string
+}
+
+// hostname is cached since it rarely changes while running.
+var hostname = sync.OnceValues(os.Hostname)
+
 // Notification represents a notification.
+//
+// The CallbackTarget must be an http or https URL. The server requests it
+// when the notification is clicked instead of the socket callback, so the
+// Callback channel of the Client does not receive the result.
+//
+// The Notification-Icon header is omitted from a NOTIFY request if the Icon
+// is nil, so the server uses the icon registered for the Name. An empty
+// string differs from nil: it is sent as an empty Notification-Icon header,
+// so the registered icon is not inherited.
+//
+// The Header is merged with the Header of the Client, and takes precedence
+// over it.
 type Notification struct {
 	Name                string
 	DisplayName         string
@@ -484,6 +1064,89 @@ type Notification struct {
 	CallbackContext     string
 	CallbackContextType string
 	CallbackTarget      string
+
+	// Custom Headers and App-Specific Headers, see Client.Header
+	Header map[string]interface{}
+}
+
+// Validate checks the Notification without sending it. It returns an error
+// if the Name is empty, the Priority is out of range, the
+// CallbackContextType is empty while the CallbackContext is not, the
+// CallbackTarget is invalid, or the type of the Icon is unsupported. A
+// NOTIFY request returns the same errors.
+func (n *Notification) Validate() error {
+	switch {
+	case n.Name == "":
+		return ErrName
+	case n.Priority < -2 || 2 < n.Priority:
+		return ErrPriority
+	case n.CallbackContext != "" && n.CallbackContextType == "":
+		return ErrContextType
+	}
+	if err := n.validateCallbackTarget(); err != nil {
+		return err
+	}
+	return checkIcon(n.Icon)
+}
+
+// checkIcon returns an error if the type of the icon is unsupported. It is
+// shared by Validate and the requests.
+func checkIcon(icon Icon) error {
+	switch icon.(type) {
+	case nil, string, []byte, image.Image, io.Reader:
+		return nil
+	}
+	return fmt.Errorf("unsupported icon: %T", icon)
+}
+
+// Clone returns a copy of the Notification. The Header and the []byte values
+// including the Icon are copied, but the io.Reader values are shared since
+// they cannot be copied, so they can be read only once by either of them.
+func (n *Notification) Clone() *Notification {
+	dup := func(v interface{}) interface{} {
+		if b, ok := v.([]byte); ok {
+			return append([]byte{}, b...)
+		}
+		return v
+	}
+	c := new(Notification)
+	*c = *n
+	c.Icon = dup(n.Icon)
+	if n.Header != nil {
+		c.Header = make(map[string]interface{}, len(n.Header))
+		for k, v := range n.Header {
+			c.Header[k] = dup(v)
+		}
+	}
+	return c
+}
+
+func (n *Notification) validateCallbackTarget() error {
+	if n.CallbackTarget != "" {
+		u, err := url.Parse(n.CallbackTarget)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return ErrCallbackTarget
+		}
+	}
+	return nil
+}
+
+// ReadText reads r until EOF, and sets it to the Text of the Notification.
+// It returns ErrTextSize without modifying the Text if r exceeds max bytes,
+// where max is not limited if it is less than or equal to 0.
+func (n *Notification) ReadText(r io.Reader, max int64) error {
+	if max > 0 {
+		r = io.LimitReader(r, max+1)
+	}
+	b, err := io.ReadAll(r)
+	switch {
+	case err != nil:
+		return err
+	case max > 0 && int64(len(b)) > max:
+		return ErrTextSize
+	}
+	n.Text = string(b)
+	return nil
 }
 
 var sanitizer = strings.NewReplacer(
@@ -495,7 +1158,7 @@ type buffer struct {
 	bytes.Buffer
 
 	c    *Client
-	list map[string][]byte
+	list map[string]chunks
 }
 
 func (b *buffer) CRLF() {
@@ -504,12 +1167,15 @@ func (b *buffer) CRLF() {
 
 func (b *buffer) Header(key string, value interface{}) {
 	if s, ok := value.(string); ok {
-		value = sanitizer.Replace(s)
+		value = b.c.HeaderEncoding.Encode(sanitizer.Replace(s))
 	}
 	fmt.Fprintf(b, "%v: %v\r\n", key, value)
 }
 
 func (b *buffer) Icon(value interface{}) (id string, err error) {
+	if err = checkIcon(value); err != nil {
+		return
+	}
 	switch v := value.(type) {
 	case nil:
 	case string:
@@ -522,49 +1188,195 @@ func (b *buffer) Icon(value interface{}) (id string, err error) {
 		if err != nil {
 			return
 		}
+		enc := b.c.PNGEncoder
+		if enc == nil {
+			enc = new(png.Encoder)
+		}
 		w := new(bytes.Buffer)
-		if err = png.Encode(w, v); err != nil {
+		if err = enc.Encode(w, v); err != nil {
 			return
 		}
 		return b.uniqueid(w.Bytes())
 	case io.Reader:
-		var data []byte
-		data, err = io.ReadAll(v)
-		if err != nil {
-			return
-		}
-		return b.uniqueid(data)
-	default:
-		err = fmt.Errorf("unsupported icon: %T", value)
+		return b.read(v)
 	}
 	return
 }
 
+// Headers writes the specified headers. The latter overrides the former when
+// they have the same key.
+func (b *buffer) Headers(hdrs ...map[string]interface{}) error {
+	m := make(map[string]interface{})
+	var keys []string
+	for _, hdr := range hdrs {
+		for k, v := range hdr {
+			k = textproto.CanonicalMIMEHeaderKey(k)
+			if _, ok := m[k]; !ok {
+				keys = append(keys, k)
+			}
+			m[k] = v
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := m[k]
+		switch id, err := b.Resource(v); {
+		case err != nil:
+			return err
+		case id != "":
+			v = id
+		}
+		b.Header(k, v)
+	}
+	return nil
+}
+
+// Origin writes the Origin-* headers of the Client.
+func (b *buffer) Origin() {
+	o := b.c.Origin
+	if o.MachineName == "" && !b.c.NoHostname {
+		if name, err := hostname(); err == nil {
+			o.MachineName = name
+		}
+	}
+	for _, h := range []struct {
+		key, value string
+	}{
+		{"Origin-Machine-Name", o.MachineName},
+		{"Origin-Software-Name", o.SoftwareName},
+		{"Origin-Software-Version", o.SoftwareVersion},
+		{"Origin-Platform-Name", o.PlatformName},
+		{"Origin-Platform-Version", o.PlatformVersion},
+	} {
+		if h.value != "" {
+			b.Header(h.key, h.value)
+		}
+	}
+}
+
+// AcceptEncoding writes the X-Accept-Encoding header of the Client.
+func (b *buffer) AcceptEncoding() {
+	if len(b.c.AcceptEncoding) != 0 {
+		b.Header("X-Accept-Encoding", strings.Join(b.c.AcceptEncoding, ", "))
+	}
+}
+
 func (b *buffer) Resource(value interface{}) (string, error) {
 	switch v := value.(type) {
 	case []byte:
 		return b.uniqueid(v)
 	case io.Reader:
-		data, err := io.ReadAll(v)
-		if err != nil {
-			return "", err
-		}
-		return b.uniqueid(data)
+		return b.read(v)
 	}
 	return "", nil
 }
 
+// read streams r through the hash into chunks, whose first chunk is
+// preallocated when the size of r is known in advance. Otherwise r is read
+// into growing chunks without copying the data which has been read.
+func (b *buffer) read(r io.Reader) (id string, err error) {
+	h, err := b.c.HashAlgorithm.New()
+	if err != nil {
+		return
+	}
+	var w chunks
+	switch v := r.(type) {
+	case interface{ Len() int }:
+		w = chunks{make([]byte, 0, v.Len())}
+	case interface{ Stat() (fs.FileInfo, error) }:
+		if fi, err := v.Stat(); err == nil && fi.Mode().IsRegular() {
+			w = chunks{make([]byte, 0, fi.Size())}
+		}
+	}
+	if _, err = io.Copy(io.MultiWriter(h, &w), r); err != nil {
+		return
+	}
+	return b.resource(h, w)
+}
+
 func (b *buffer) uniqueid(data []byte) (id string, err error) {
 	h, err := b.c.HashAlgorithm.New()
 	if err != nil {
 		return
 	}
 	h.Write(data)
-	id = fmt.Sprintf("x-growl-resource://%X", h.Sum(nil))
-	b.list[id[19:]] = data
+	return b.resource(h, chunks{data})
+}
+
+func (b *buffer) resource(h hash.Hash, data chunks) (string, error) {
+	id := fmt.Sprintf("%X", h.Sum(nil))
+	if b.c.ResourceStore != nil {
+		return b.c.ResourceStore.Store(id, data.Bytes())
+	}
+	b.list[id] = data
+	return ResourceScheme + id, nil
+}
+
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (lr *limitedReader) Read(p []byte) (n int, err error) {
+	if lr.n <= 0 {
+		return 0, ErrResponseSize
+	}
+	if int64(len(p)) > lr.n {
+		p = p[:lr.n]
+	}
+	n, err = lr.r.Read(p)
+	lr.n -= int64(n)
 	return
 }
 
+// chunks is a binary resource which consists of one or more byte slices.
+type chunks [][]byte
+
+const (
+	minChunkSize = 32 << 10
+	maxChunkSize = 1 << 20
+)
+
+// Len returns the total length of the chunks.
+func (c chunks) Len() (n int) {
+	for _, p := range c {
+		n += len(p)
+	}
+	return
+}
+
+// Bytes returns the concatenated chunks.
+func (c chunks) Bytes() []byte {
+	switch len(c) {
+	case 0:
+		return nil
+	case 1:
+		return c[0]
+	}
+	return bytes.Join(c, nil)
+}
+
+// Write appends p to the last chunk, and adds a new chunk which is twice as
+// large as the last one up to maxChunkSize when it is full.
+func (c *chunks) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := len(*c) - 1
+		if i < 0 || len((*c)[i]) == cap((*c)[i]) {
+			size := minChunkSize
+			if i >= 0 {
+				size = min(max(2*cap((*c)[i]), minChunkSize), maxChunkSize)
+			}
+			*c = append(*c, make([]byte, 0, size))
+			i++
+		}
+		m := min(cap((*c)[i])-len((*c)[i]), len(p))
+		(*c)[i] = append((*c)[i], p[:m]...)
+		p = p[m:]
+	}
+	return n, nil
+}
+
 // Info represents a GNTP information line.
 type Info struct {
 	Version             string
@@ -578,6 +1390,40 @@ type Info struct {
 	cipher cipher.Block
 }
 
+// clone returns a copy of the Info without the cipher.
+func (i *Info) clone() *Info {
+	dup := func(b []byte) []byte {
+		if b == nil {
+			return nil
+		}
+		return append([]byte{}, b...)
+	}
+	return &Info{
+		Version:             i.Version,
+		MessageType:         i.MessageType,
+		EncryptionAlgorithm: i.EncryptionAlgorithm,
+		IV:                  dup(i.IV),
+		HashAlgorithm:       i.HashAlgorithm,
+		KeyHash:             dup(i.KeyHash),
+		Salt:                dup(i.Salt),
+	}
+}
+
+// VerifyPassword reports whether the password matches the key hash of the
+// specified GNTP information line. It returns false without an error if the
+// password is incorrect, and an error if the line is malformed. A line
+// without a key hash matches only the empty password.
+func VerifyPassword(l, password string) (bool, error) {
+	i, err := ParseInfo(l, password)
+	switch {
+	case err == ErrPassword:
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	return i.KeyHash != nil || password == "", nil
+}
+
 // ParseInfo parses a GNTP information line.
 func ParseInfo(l, password string) (i *Info, err error) {
 	var x int
@@ -677,16 +1523,11 @@ func ParseInfo(l, password string) (i *Info, err error) {
 				goto Error
 			}
 			// verify <keyHash>
-			h, err := i.HashAlgorithm.New()
+			k, keyHash, err := DeriveKey(i.HashAlgorithm, password, i.Salt)
 			if err != nil {
 				return nil, err
 			}
-			io.WriteString(h, password)
-			h.Write(i.Salt)
-			k := h.Sum(nil)
-			h.Reset()
-			h.Write(k)
-			if !reflect.DeepEqual(h.Sum(nil), kh) {
+			if !reflect.DeepEqual(keyHash, kh) {
 				return nil, ErrPassword
 			}
 			i.KeyHash = kh
@@ -707,6 +1548,22 @@ Error:
 	return nil, ErrProtocol
 }
 
+// DeriveKey computes the key and the key hash from the specified password and
+// salt with the hash algorithm.
+func DeriveKey(ha HashAlgorithm, password string, salt []byte) (key, keyHash []byte, err error) {
+	h, err := ha.New()
+	if err != nil {
+		return
+	}
+	io.WriteString(h, password)
+	h.Write(salt)
+	key = h.Sum(nil)
+	h.Reset()
+	h.Write(key)
+	keyHash = h.Sum(nil)
+	return
+}
+
 // Decrypt decrypts the specified data and removes the PKCS #7 padding.
 func (i *Info) Decrypt(data []byte) ([]byte, error) {
 	if i.cipher == nil {
@@ -765,18 +1622,11 @@ func (i *Info) SetPassword(password string) (err error) {
 			}
 		}
 		// key
-		var h hash.Hash
-		h, err = i.HashAlgorithm.New()
+		var k []byte
+		k, i.KeyHash, err = DeriveKey(i.HashAlgorithm, password, i.Salt)
 		if err != nil {
 			return
 		}
-		io.WriteString(h, password)
-		h.Write(i.Salt)
-		k := h.Sum(nil)
-		// key hash
-		h.Reset()
-		h.Write(k)
-		i.KeyHash = h.Sum(nil)
 
 		if i.EncryptionAlgorithm != NONE {
 			i.cipher, err = i.EncryptionAlgorithm.New(k)
@@ -795,6 +1645,23 @@ func (i *Info) SetPassword(password string) (err error) {
 	return
 }
 
+// RoundTrip encrypts the specified data with the Info which is initialized
+// by the specified algorithms and password, and decrypts the result again.
+// It is intended to debug the interoperability of the encryption.
+func RoundTrip(ea EncryptionAlgorithm, ha HashAlgorithm, password string, data []byte) (encrypted, decrypted []byte, err error) {
+	i := &Info{
+		Version:             "1.0",
+		HashAlgorithm:       ha,
+		EncryptionAlgorithm: ea,
+	}
+	if err = i.SetPassword(password); err != nil {
+		return
+	}
+	encrypted = i.Encrypt(data)
+	decrypted, err = i.Decrypt(encrypted)
+	return
+}
+
 func (i *Info) String() string {
 	switch {
 	case i.EncryptionAlgorithm != NONE:
@@ -810,10 +1677,38 @@ func (i *Info) String() string {
 }
 
 // Response represents a GNTP response.
+//
+// The Header has the headers of the -OK response except Response-Action,
+// Notification-ID, and X-Content-Encoding. GNTP does not define the result
+// of each notification of a REGISTER request, so any feedback which the
+// server includes, such as an echo of Notification-Name, is available only
+// through the Header.
 type Response struct {
-	Action string
-	ID     string
-	Header textproto.MIMEHeader
+	Action          string
+	ID              string
+	ContentEncoding string // see Client.AcceptEncoding
+	Header          textproto.MIMEHeader
+
+	c    *Client
+	conn net.Conn
+}
+
+// Cancel closes the connection which is waiting for the socket callback of
+// the notification, so its callback is no longer received. Other connections
+// are left open unlike Reset. It does nothing if the Response does not have
+// such a connection.
+func (r *Response) Cancel() {
+	if r == nil || r.conn == nil {
+		return
+	}
+
+	r.c.mu.Lock()
+	defer r.c.mu.Unlock()
+
+	if _, ok := r.c.cb[r.conn]; ok {
+		r.conn.Close()
+		delete(r.c.cb, r.conn)
+	}
 }
 
 // Callback represents a GNTP callback
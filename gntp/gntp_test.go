@@ -1,7 +1,7 @@
 //
 // go.notify/gntp :: gntp_test.go
 //
-//   Copyright (c) 2017-2022 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2017-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -10,20 +10,35 @@ package gntp_test
 
 import (
 	"bytes"
+	"context"
 	"crypto/cipher"
+	"crypto/md5"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"image"
+	"image/png"
 	"io"
+	"mime"
 	"net"
 	"net/textproto"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"testing/iotest"
 	"time"
+	"unicode/utf8"
 
 	"github.com/hattya/go.notify/gntp"
 )
@@ -33,6 +48,15 @@ const (
 	password = "password"
 )
 
+func TestNew(t *testing.T) {
+	if g, e := gntp.Localhost(), fmt.Sprintf("%v:%v", gntp.DefaultServer, gntp.DefaultPort); g != e {
+		t.Errorf("Localhost() = %v, expected %v", g, e)
+	}
+	if g, e := gntp.New().Server, gntp.Localhost(); g != e {
+		t.Errorf("Client.Server = %v, expected %v", g, e)
+	}
+}
+
 func TestRegister(t *testing.T) {
 	s := NewServer()
 	defer s.Close()
@@ -175,6 +199,120 @@ func TestRegister(t *testing.T) {
 	}
 }
 
+func TestRegisterPNGEncoder(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+
+	img := image.NewGray(image.Rect(0, 0, 256, 256))
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			img.Pix[y*img.Stride+x] = uint8(x ^ y)
+		}
+	}
+	size := func(enc *png.Encoder) int {
+		c.Icon = img
+		c.PNGEncoder = enc
+		s.MockOK("REGISTER", gntp.NONE)
+		if _, err := c.Register(nil); err != nil {
+			t.Fatal(err)
+		}
+		for _, data := range s.LastRequest().Resources {
+			return len(data)
+		}
+		t.Fatal("no resources")
+		return 0
+	}
+	b := new(bytes.Buffer)
+	if err := png.Encode(b, img); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := size(nil), b.Len(); g != e {
+		t.Errorf("default: size = %v, expected %v", g, e)
+	}
+	no := size(&png.Encoder{CompressionLevel: png.NoCompression})
+	best := size(&png.Encoder{CompressionLevel: png.BestCompression})
+	if no <= best {
+		t.Errorf("expected NoCompression (%v) > BestCompression (%v)", no, best)
+	}
+}
+
+func TestResourceScheme(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+	c.Icon = []byte("icon")
+
+	s.MockOK("REGISTER", gntp.NONE)
+	if _, err := c.Register(nil); err != nil {
+		t.Fatal(err)
+	}
+	req := s.LastRequest()
+	v := req.Header.Get("Application-Icon")
+	if !strings.HasPrefix(v, gntp.ResourceScheme) {
+		t.Fatalf("expected %q prefix, got %q", gntp.ResourceScheme, v)
+	}
+	id := v[len(gntp.ResourceScheme):]
+	if g, e := len(id), 2*md5.Size; g != e {
+		t.Errorf("expected id of length %v, got %q", e, id)
+	}
+	if g, e := req.Resources[id], c.Icon.([]byte); !bytes.Equal(g, e) {
+		t.Errorf("expected %q, got %q", e, g)
+	}
+}
+
+func TestRegisterResponse(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+
+	for _, ea := range []gntp.EncryptionAlgorithm{gntp.NONE, gntp.AES} {
+		if ea != gntp.NONE {
+			s.SetPassword(password)
+			c.Password = password
+			c.HashAlgorithm = gntp.SHA256
+			c.EncryptionAlgorithm = ea
+		}
+		// echo the registered notifications
+		hdr := textproto.MIMEHeader{
+			"X-Notification-Name":    {"A", "B"},
+			"X-Notification-Enabled": {"True", "False"},
+		}
+		s.MockOKHeader("REGISTER", ea, hdr)
+		resp, err := c.Register([]*gntp.Notification{
+			{Name: "A", Enabled: true},
+			{Name: "B"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, e := resp.Action, "REGISTER"; g != e {
+			t.Errorf("Response.Action = %v, expected %v", g, e)
+		}
+		if !reflect.DeepEqual(resp.Header, hdr) {
+			t.Errorf("Response.Header = %v, expected %v", resp.Header, hdr)
+		}
+		req := s.LastRequest()
+		if g, e := len(req.Notifications), 2; g != e {
+			t.Fatalf("expected %v notifications, got %v", e, g)
+		}
+		for i, n := range []string{"A", "B"} {
+			if g := req.Notifications[i].Get("Notification-Name"); g != n {
+				t.Errorf("Notification-Name = %v, expected %v", g, n)
+			}
+		}
+	}
+}
+
 func TestRegisterError(t *testing.T) {
 	s := NewServer()
 	defer s.Close()
@@ -224,6 +362,127 @@ func TestRegisterError(t *testing.T) {
 	}
 }
 
+func TestErrorDescription(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+
+	for _, tt := range []struct {
+		code int
+		desc string
+	}{
+		{int(gntp.NotAuthorized), "Not Authorized"},
+		{999, "Unknown Error (999)"},
+	} {
+		s.MockResponse(func(conn net.Conn) {
+			io.WriteString(conn, "GNTP/1.0 -ERROR NONE\r\n")
+			fmt.Fprintf(conn, "Error-Code: %v\r\n", tt.code)
+			io.WriteString(conn, "\r\n")
+		})
+		_, err := c.Register(nil)
+		if e, ok := err.(gntp.Error); !ok {
+			t.Errorf("expected gntp.Error, got %#v", err)
+		} else if e.Description != tt.desc {
+			t.Errorf("Error.Description = %q, expected %q", e.Description, tt.desc)
+		}
+	}
+}
+
+func TestRegisterLimit(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+	c.Icon = []byte("icon")
+	c.MaxNotifications = 2
+	c.MaxResources = 2
+
+	n := []*gntp.Notification{
+		{Name: "1", Icon: []byte("1")},
+		{Name: "2", Icon: []byte("icon")},
+	}
+	s.MockOK("REGISTER", gntp.NONE)
+	if _, err := c.Register(n); err != nil {
+		t.Fatal(err)
+	}
+	// notifications
+	if _, err := c.Register(append(n, &gntp.Notification{Name: "3"})); !errors.Is(err, gntp.ErrLimit) {
+		t.Errorf("expected ErrLimit, got %#v", err)
+	}
+	// resources
+	n[1].Icon = []byte("2")
+	if _, err := c.Register(n); !errors.Is(err, gntp.ErrLimit) {
+		t.Errorf("expected ErrLimit, got %#v", err)
+	}
+	// unlimited
+	c.MaxNotifications = 0
+	c.MaxResources = 0
+	s.MockOK("REGISTER", gntp.NONE)
+	if _, err := c.Register(append(n, &gntp.Notification{Name: "3"})); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRegisterLargeIcon(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+
+	const size = 16 << 20
+	b := make([]byte, size)
+	for _, tt := range []struct {
+		name string
+		r    io.Reader
+	}{
+		{"sized", bytes.NewReader(b)},
+		{"unsized", struct{ io.Reader }{bytes.NewReader(b)}},
+	} {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		c.Icon = tt.r
+		_, err := c.NewRegisterRequest(nil, nil)
+		runtime.ReadMemStats(&after)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := after.TotalAlloc - before.TotalAlloc; n > size+size/4 {
+			t.Errorf("%v: NewRegisterRequest allocates %v bytes, expected <= %v", tt.name, n, size+size/4)
+		}
+	}
+	// send
+	for _, tt := range []struct {
+		r    io.Reader
+		size int
+	}{
+		{bytes.NewReader(b), size},
+		{iotest.OneByteReader(bytes.NewReader(b[:100<<10])), 100 << 10},
+	} {
+		s.MockOK("REGISTER", gntp.NONE)
+		c.Icon = tt.r
+		if _, err := c.Register(nil); err != nil {
+			t.Fatal(err)
+		}
+		req := s.LastRequest()
+		if g, e := len(req.Resources), 1; g != e {
+			t.Fatalf("expected %v resources, got %v", e, g)
+		}
+		for _, data := range req.Resources {
+			if g, e := len(data), tt.size; g != e {
+				t.Errorf("expected %v bytes, got %v", e, g)
+			}
+		}
+	}
+}
+
 func TestNotify(t *testing.T) {
 	s := NewServer()
 	defer s.Close()
@@ -281,7 +540,7 @@ func TestNotify(t *testing.T) {
 			Sticky:         true,
 			Priority:       2,
 			CoalescingID:   "CoalescingID",
-			CallbackTarget: "CallbackTarget",
+			CallbackTarget: "https://example.com/callback",
 		})
 		if err != nil {
 			t.Error(err)
@@ -332,7 +591,7 @@ func TestNotify(t *testing.T) {
 			Priority:       2,
 			Icon:           tt.icon,
 			CoalescingID:   "CoalescingID",
-			CallbackTarget: "CallbackTarget",
+			CallbackTarget: "https://example.com/callback",
 		})
 		if err != nil {
 			t.Error(err)
@@ -372,7 +631,7 @@ func TestNotify(t *testing.T) {
 			Sticky:         true,
 			Priority:       2,
 			CoalescingID:   "CoalescingID",
-			CallbackTarget: "CallbackTarget",
+			CallbackTarget: "https://example.com/callback",
 		})
 		if err != nil {
 			t.Error(err)
@@ -380,143 +639,1190 @@ func TestNotify(t *testing.T) {
 	}
 }
 
-func TestNotifyError(t *testing.T) {
-	s := NewServer()
+func TestOpts(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+	c.Header["X-Client"] = "client"
+
+	var wg sync.WaitGroup
+	errc := make(chan error, 16)
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		s.MockOK("REGISTER", gntp.NONE)
+		s.MockOK("NOTIFY", gntp.NONE)
+		go func(i int) {
+			defer wg.Done()
+
+			opts := &gntp.RegisterOpts{
+				Icon:   []byte{byte(i)},
+				Header: map[string]interface{}{"X-Call": i},
+			}
+			if _, err := c.RegisterWithOpts([]*gntp.Notification{{Name: "Name"}}, opts); err != nil {
+				errc <- err
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+
+			opts := &gntp.NotifyOpts{
+				Header: map[string]interface{}{
+					"X-Call":   i,
+					"X-Client": "call",
+				},
+			}
+			if _, err := c.NotifyWithOpts(context.Background(), &gntp.Notification{Name: "Name"}, opts); err != nil {
+				errc <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		t.Error(err)
+	}
+	if g, e := c.Header, map[string]interface{}{"X-Client": "client"}; !reflect.DeepEqual(g, e) {
+		t.Errorf("Client.Header = %v, expected %v", g, e)
+	}
+	// precedence
+	s.MockOK("NOTIFY", gntp.NONE)
+	n := &gntp.Notification{
+		Name:   "Name",
+		Header: map[string]interface{}{"X-Call": "notification"},
+	}
+	opts := &gntp.NotifyOpts{
+		Header: map[string]interface{}{
+			"X-Call":   "opts",
+			"X-Client": "opts",
+		},
+	}
+	if _, err := c.NotifyWithOpts(context.Background(), n, opts); err != nil {
+		t.Fatal(err)
+	}
+	req := s.LastRequest()
+	if g, e := req.Header.Get("X-Call"), "notification"; g != e {
+		t.Errorf("X-Call = %v, expected %v", g, e)
+	}
+	if g, e := req.Header.Get("X-Client"), "opts"; g != e {
+		t.Errorf("X-Client = %v, expected %v", g, e)
+	}
+	s.MockOK("REGISTER", gntp.NONE)
+	if _, err := c.RegisterWithOpts(nil, &gntp.RegisterOpts{Icon: "https://example.com/icon.png"}); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := s.LastRequest().Header.Get("Application-Icon"), "https://example.com/icon.png"; g != e {
+		t.Errorf("Application-Icon = %v, expected %v", g, e)
+	}
+}
+
+func TestLastInfo(t *testing.T) {
+	s := NewServer()
+	s.SetPassword(password)
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+	c.Password = password
+	c.HashAlgorithm = gntp.SHA256
+	c.EncryptionAlgorithm = gntp.AES
+
+	if i := c.LastInfo(); i != nil {
+		t.Errorf("expected nil, got %v", i)
+	}
+	s.MockOK("REGISTER", gntp.AES)
+	if _, err := c.Register(nil); err != nil {
+		t.Fatal(err)
+	}
+	i := c.LastInfo()
+	switch {
+	case i == nil:
+		t.Fatal("expected non-nil")
+	case i.MessageType != "REGISTER":
+		t.Errorf("expected REGISTER, got %v", i.MessageType)
+	case len(i.Salt) == 0:
+		t.Error("Salt is empty")
+	case len(i.IV) != 16:
+		t.Errorf("expected 16 bytes IV, got %v", i.IV)
+	case len(i.KeyHash) == 0:
+		t.Error("KeyHash is empty")
+	case i.Cipher() != nil:
+		t.Error("expected nil cipher")
+	}
+	if g, e := i.String(), s.LastRequest().Info.String(); g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	// copy
+	i.Salt[0] ^= 0xff
+	if reflect.DeepEqual(c.LastInfo().Salt, i.Salt) {
+		t.Error("LastInfo returns shared Salt")
+	}
+	// Request.Build
+	i = c.LastInfo()
+	r, err := c.NewNotifyRequest(&gntp.Notification{Name: "Name"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Build(); err != nil {
+		t.Fatal(err)
+	}
+	if g := c.LastInfo(); !reflect.DeepEqual(g, i) {
+		t.Errorf("expected %v, got %v", i, g)
+	}
+}
+
+func TestNotificationValidate(t *testing.T) {
+	for _, n := range []*gntp.Notification{
+		{Name: "Name"},
+		{
+			Name:                "Name",
+			Priority:            -2,
+			Icon:                "https://example.com/icon.png",
+			CallbackContext:     "context",
+			CallbackContextType: "type",
+			CallbackTarget:      "https://example.com/callback",
+		},
+		{Name: "Name", Priority: 2, Icon: []byte("icon")},
+		{Name: "Name", Icon: image.NewGray(image.Rect(0, 0, 16, 16))},
+		{Name: "Name", Icon: strings.NewReader("icon")},
+	} {
+		if err := n.Validate(); err != nil {
+			t.Error(err)
+		}
+	}
+	// error
+	c := gntp.New()
+	c.Name = name
+	for _, tt := range []struct {
+		n   *gntp.Notification
+		err error
+	}{
+		{&gntp.Notification{}, gntp.ErrName},
+		{&gntp.Notification{Name: "Name", Priority: -3}, gntp.ErrPriority},
+		{&gntp.Notification{Name: "Name", Priority: 3}, gntp.ErrPriority},
+		{&gntp.Notification{Name: "Name", CallbackContext: "context"}, gntp.ErrContextType},
+		{&gntp.Notification{Name: "Name", CallbackTarget: "file:///"}, gntp.ErrCallbackTarget},
+		{&gntp.Notification{Name: "Name", CallbackTarget: "https://"}, gntp.ErrCallbackTarget},
+	} {
+		if err := tt.n.Validate(); err != tt.err {
+			t.Errorf("expected %v, got %#v", tt.err, err)
+		}
+		// same as Notify
+		if _, err := c.Notify(tt.n); err != tt.err {
+			t.Errorf("Notify: expected %v, got %#v", tt.err, err)
+		}
+	}
+	n := &gntp.Notification{Name: "Name", Icon: 1}
+	if err := n.Validate(); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := c.Notify(n); err == nil {
+		t.Error("Notify: expected error")
+	}
+}
+
+func TestNotificationReadText(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+
+	text := "log message"
+	for _, max := range []int64{0, -1, int64(len(text))} {
+		n := &gntp.Notification{Name: "Name"}
+		if err := n.ReadText(strings.NewReader(text), max); err != nil {
+			t.Fatal(err)
+		}
+		if g, e := n.Text, text; g != e {
+			t.Errorf("expected %q, got %q", e, g)
+		}
+		s.MockOK("NOTIFY", gntp.NONE)
+		if _, err := c.Notify(n); err != nil {
+			t.Fatal(err)
+		}
+		if g, e := s.LastRequest().Header.Get("Notification-Text"), text; g != e {
+			t.Errorf("expected %q, got %q", e, g)
+		}
+	}
+	// error
+	n := &gntp.Notification{Text: "Text"}
+	if err := n.ReadText(strings.NewReader(text), int64(len(text))-1); err != gntp.ErrTextSize {
+		t.Errorf("expected ErrTextSize, got %#v", err)
+	}
+	if err := n.ReadText(new(reader), 0); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %#v", err)
+	}
+	if g, e := n.Text, "Text"; g != e {
+		t.Errorf("expected %q, got %q", e, g)
+	}
+}
+
+func TestNotificationClone(t *testing.T) {
+	n := &gntp.Notification{
+		Name: "Name",
+		Icon: []byte("icon"),
+		Header: map[string]interface{}{
+			"X-Data": []byte("data"),
+		},
+	}
+	c := n.Clone()
+	if !reflect.DeepEqual(c, n) {
+		t.Errorf("expected %#v, got %#v", n, c)
+	}
+	c.Icon.([]byte)[0] = 'I'
+	c.Header["X-Data"].([]byte)[0] = 'D'
+	c.Header["X-Name"] = "Name"
+	if g, e := string(n.Icon.([]byte)), "icon"; g != e {
+		t.Errorf("expected %q, got %q", e, g)
+	}
+	if g, e := string(n.Header["X-Data"].([]byte)), "data"; g != e {
+		t.Errorf("expected %q, got %q", e, g)
+	}
+	if _, ok := n.Header["X-Name"]; ok {
+		t.Error("expected Header not to be shared")
+	}
+}
+
+func TestCallbackTarget(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+
+	for _, target := range []string{
+		"http://example.com/callback",
+		"https://example.com/callback?id=1",
+	} {
+		s.MockOK("NOTIFY", gntp.NONE)
+		if _, err := c.Notify(&gntp.Notification{Name: "Name", CallbackTarget: target}); err != nil {
+			t.Errorf("%v: %v", target, err)
+		}
+	}
+	// error
+	for _, target := range []string{
+		"CallbackTarget",
+		"example.com/callback",
+		"ftp://example.com/callback",
+		"https://",
+		"http://[::1",
+	} {
+		if _, err := c.Notify(&gntp.Notification{Name: "Name", CallbackTarget: target}); err != gntp.ErrCallbackTarget {
+			t.Errorf("%v: expected ErrCallbackTarget, got %v", target, err)
+		}
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+
+	host, err := os.Hostname()
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, tt := range []struct {
+		origin     gntp.Origin
+		noHostname bool
+		e          map[string]string
+	}{
+		{
+			e: map[string]string{
+				"Origin-Machine-Name": host,
+			},
+		},
+		{
+			noHostname: true,
+			e:          map[string]string{},
+		},
+		{
+			origin: gntp.Origin{
+				MachineName:     "machine",
+				SoftwareName:    "software",
+				SoftwareVersion: "1.0",
+				PlatformName:    "platform",
+				PlatformVersion: "2.0",
+			},
+			e: map[string]string{
+				"Origin-Machine-Name":     "machine",
+				"Origin-Software-Name":    "software",
+				"Origin-Software-Version": "1.0",
+				"Origin-Platform-Name":    "platform",
+				"Origin-Platform-Version": "2.0",
+			},
+		},
+	} {
+		c.Origin = tt.origin
+		c.NoHostname = tt.noHostname
+		s.MockOK("REGISTER", gntp.NONE)
+		if _, err := c.Register(nil); err != nil {
+			t.Fatal(err)
+		}
+		hdrs := []textproto.MIMEHeader{s.LastRequest().Header}
+		s.MockOK("NOTIFY", gntp.NONE)
+		if _, err := c.Notify(&gntp.Notification{Name: "Name"}); err != nil {
+			t.Fatal(err)
+		}
+		hdrs = append(hdrs, s.LastRequest().Header)
+		for _, hdr := range hdrs {
+			g := make(map[string]string)
+			for k := range hdr {
+				if strings.HasPrefix(k, "Origin-") {
+					g[k] = hdr.Get(k)
+				}
+			}
+			if !reflect.DeepEqual(g, tt.e) {
+				t.Errorf("expected %v, got %v", tt.e, g)
+			}
+		}
+	}
+}
+
+func TestAcceptEncoding(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+
+	// not advertised
+	s.MockOK("REGISTER", gntp.NONE)
+	if _, err := c.Register(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.LastRequest().Header["X-Accept-Encoding"]; ok {
+		t.Error("unexpected X-Accept-Encoding")
+	}
+	// advertised
+	c.AcceptEncoding = []string{"gzip", "deflate"}
+	hdr := textproto.MIMEHeader{"X-Content-Encoding": {"gzip"}}
+	for _, mt := range []string{"REGISTER", "NOTIFY"} {
+		s.MockOKHeader(mt, gntp.NONE, hdr)
+		var resp *gntp.Response
+		var err error
+		if mt == "REGISTER" {
+			resp, err = c.Register(nil)
+		} else {
+			resp, err = c.Notify(&gntp.Notification{Name: "Name"})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, e := s.LastRequest().Header.Get("X-Accept-Encoding"), "gzip, deflate"; g != e {
+			t.Errorf("%v: expected %q, got %q", mt, e, g)
+		}
+		if g, e := resp.ContentEncoding, "gzip"; g != e {
+			t.Errorf("%v: expected %q, got %q", mt, e, g)
+		}
+		if _, ok := resp.Header["X-Content-Encoding"]; ok {
+			t.Errorf("%v: unexpected X-Content-Encoding", mt)
+		}
+	}
+	c.Wait()
+}
+
+func TestHeaderEncoding(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+
+	dec := new(mime.WordDecoder)
+	for _, tt := range []struct {
+		he     gntp.HeaderEncoding
+		decode func(string) (string, error)
+	}{
+		{gntp.RawUTF8, func(s string) (string, error) { return s, nil }},
+		{gntp.RFC2047, dec.DecodeHeader},
+		{gntp.PercentEncoding, url.PathUnescape},
+	} {
+		c.HeaderEncoding = tt.he
+		for _, title := range []string{
+			"Title",
+			"100% Title",
+			"タイトル",
+			"100% タイトル",
+		} {
+			s.MockOK("NOTIFY", gntp.NONE)
+			if _, err := c.Notify(&gntp.Notification{Name: "Name", Title: title}); err != nil {
+				t.Fatal(err)
+			}
+			v := s.LastRequest().Header.Get("Notification-Title")
+			if tt.he != gntp.RawUTF8 {
+				for _, r := range v {
+					if r >= utf8.RuneSelf {
+						t.Errorf("%v: expected ASCII, got %q", tt.he, v)
+						break
+					}
+				}
+			}
+			switch g, err := tt.decode(v); {
+			case err != nil:
+				t.Error(err)
+			case g != title:
+				t.Errorf("%v: expected %q, got %q", tt.he, title, g)
+			}
+		}
+	}
+}
+
+func TestEncryptedHeader(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+	c.Password = password
+	c.HashAlgorithm = gntp.SHA256
+	c.Header = map[string]interface{}{
+		"X-Foo":    "foo",
+		"Data-Bar": []byte("bar"),
+	}
+	s.SetPassword(password)
+
+	for _, ea := range []gntp.EncryptionAlgorithm{
+		gntp.DES,
+		gntp.TDES,
+		gntp.AES,
+	} {
+		c.EncryptionAlgorithm = ea
+		s.MockOK("REGISTER", ea)
+		if _, err := c.Register(nil); err != nil {
+			t.Fatal(err)
+		}
+		s.MockOK("NOTIFY", ea)
+		if _, err := c.Notify(&gntp.Notification{Name: "Name"}); err != nil {
+			t.Fatal(err)
+		}
+		req := s.LastRequest()
+		if g, e := req.Info.EncryptionAlgorithm, ea; g != e {
+			t.Errorf("expected %v, got %v", e, g)
+		}
+		if g, e := req.Header.Get("X-Foo"), "foo"; g != e {
+			t.Errorf("X-Foo: expected %q, got %q", e, g)
+		}
+		id, ok := strings.CutPrefix(req.Header.Get("Data-Bar"), gntp.ResourceScheme)
+		if !ok {
+			t.Fatalf("Data-Bar: unexpected value %q", req.Header.Get("Data-Bar"))
+		}
+		if g, e := req.Resources[id], []byte("bar"); !bytes.Equal(g, e) {
+			t.Errorf("Data-Bar: expected %q, got %q", e, g)
+		}
+	}
+}
+
+func TestNotifyError(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+
+	s.MockOK("REGISTER", gntp.NONE)
+	_, err := c.Register([]*gntp.Notification{
+		{
+			Name:    "Name",
+			Enabled: true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// unsupported icon
+	_, err = c.Notify(&gntp.Notification{
+		Name:  "Name",
+		Title: "Title",
+		Text:  "Text",
+		Icon:  0,
+	})
+	if err == nil {
+		t.Error("expected error")
+	}
+	// image error
+	for _, img := range []image.Image{
+		image.NewAlpha(image.Rect(0, 0, 32, 32)),
+		image.NewGray(image.Rect(0, 0, 0, 0)),
+	} {
+		_, err = c.Notify(&gntp.Notification{
+			Name:  "Name",
+			Title: "Title",
+			Text:  "Text",
+			Icon:  img,
+		})
+		if err == nil {
+			t.Error("expected error")
+		}
+	}
+	// read error
+	_, err = c.Notify(&gntp.Notification{
+		Name:  "Name",
+		Title: "Title",
+		Text:  "Text",
+		Icon:  new(reader),
+	})
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	c.Header["X-Header"] = new(reader)
+	_, err = c.Notify(&gntp.Notification{
+		Name:  "Name",
+		Title: "Title",
+		Text:  "Text",
+	})
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	delete(c.Header, "X-Header")
+	// unknown hash algorithm
+	c.HashAlgorithm = -1
+	_, err = c.Notify(&gntp.Notification{
+		Name:  "Name",
+		Title: "Title",
+		Text:  "Text",
+		Icon:  []byte("[]byte"),
+	})
+	if err != gntp.ErrHash {
+		t.Errorf("expected ErrHash, got %v", err)
+	}
+}
+
+type reader struct {
+}
+
+func (r *reader) Read([]byte) (int, error) { return 0, io.ErrUnexpectedEOF }
+
+func TestCallback(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+
+	s.MockOK("REGISTER", gntp.NONE)
+	_, err := c.Register([]*gntp.Notification{
+		{
+			Name:    "Name",
+			Enabled: true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ea := range []gntp.EncryptionAlgorithm{
+		gntp.NONE,
+		gntp.DES,
+		gntp.TDES,
+		gntp.AES,
+	} {
+		for i := 0; i < 10; i++ {
+			if ea != gntp.NONE {
+				s.SetPassword(password)
+				c.Password = password
+			} else {
+				s.SetPassword("")
+				c.Password = ""
+			}
+			res := gntp.Result((i % 3) + 1)
+			s.MockCallback(res, ea)
+			_, err := c.Notify(&gntp.Notification{
+				Name:                "Name",
+				CallbackContext:     strconv.Itoa(i),
+				CallbackContextType: "int",
+			})
+			if err != nil {
+				t.Error(err)
+			} else if g := <-c.Callback; g.Result != res {
+				t.Errorf("expected %v, got %v", res, g.Result)
+			}
+		}
+	}
+
+	s.MockCallback(gntp.TIMEOUT, gntp.NONE)
+	if _, err := c.Notify(&gntp.Notification{Name: "Name"}); err != nil {
+		t.Error(err)
+	}
+	time.Sleep(time.Microsecond)
+	c.Reset()
+	c.Wait()
+}
+
+func TestRequestBuild(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.SetPassword(password)
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+	c.Password = password
+	c.HashAlgorithm = gntp.SHA256
+	c.EncryptionAlgorithm = gntp.AES
+	c.Icon = []byte("icon")
+
+	// REGISTER
+	r, err := c.NewRegisterRequest([]*gntp.Notification{{Name: "Name", Enabled: true}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b1, err := r.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := r.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(b1, b2) {
+		t.Error("expected different salt and IV")
+	}
+	for _, b := range [][]byte{b1, b2} {
+		s.MockOK("REGISTER", gntp.AES)
+		resp, err := c.SendBytes(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, e := resp.Action, "REGISTER"; g != e {
+			t.Errorf("expected %q, got %q", e, g)
+		}
+		req := s.LastRequest()
+		if g, e := req.Header.Get("Application-Name"), name; g != e {
+			t.Errorf("expected %q, got %q", e, g)
+		}
+		if g, e := len(req.Notifications), 1; g != e {
+			t.Fatalf("expected %v notifications, got %v", e, g)
+		}
+		id := strings.TrimPrefix(req.Header.Get("Application-Icon"), gntp.ResourceScheme)
+		if g, e := req.Resources[id], c.Icon.([]byte); !bytes.Equal(g, e) {
+			t.Errorf("expected %q, got %q", e, g)
+		}
+	}
+	// NOTIFY
+	r, err = c.NewNotifyRequest(&gntp.Notification{Name: "Name", Title: "Title"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := r.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.MockCallback(gntp.CLICKED, gntp.AES)
+	resp, err := c.SendBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := resp.Action, "NOTIFY"; g != e {
+		t.Errorf("expected %q, got %q", e, g)
+	}
+	if g, e := s.LastRequest().Header.Get("Notification-Title"), "Title"; g != e {
+		t.Errorf("expected %q, got %q", e, g)
+	}
+	if cb := <-c.Callback; cb.Result != gntp.CLICKED {
+		t.Errorf("expected %v, got %v", gntp.CLICKED, cb.Result)
+	}
+	// error
+	if _, err := c.NewRegisterRequest(nil, &gntp.RegisterOpts{Icon: 1}); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := c.NewNotifyRequest(&gntp.Notification{Name: "Name", CallbackTarget: "file:///"}, nil); err != gntp.ErrCallbackTarget {
+		t.Errorf("expected ErrCallbackTarget, got %#v", err)
+	}
+	if _, err := c.SendBytes([]byte("GNTP/1.0\r\n")); err != gntp.ErrProtocol {
+		t.Errorf("expected ErrProtocol, got %#v", err)
+	}
+	c.Wait()
+}
+
+func TestNotifyInheritIcon(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+	c.Icon = "icon"
+
+	for _, tt := range []struct {
+		icon gntp.Icon
+		ok   bool
+		e    string
+	}{
+		{nil, false, ""},
+		{"", true, ""},
+		{"url", true, "url"},
+	} {
+		s.MockOK("NOTIFY", gntp.NONE)
+		if _, err := c.Notify(&gntp.Notification{Name: "Name", Icon: tt.icon}); err != nil {
+			t.Fatal(err)
+		}
+		vals, ok := s.LastRequest().Header["Notification-Icon"]
+		if ok != tt.ok {
+			t.Errorf("Notification-Icon for %#v: expected %v, got %v", tt.icon, tt.ok, ok)
+		} else if ok && vals[0] != tt.e {
+			t.Errorf("expected %q, got %q", tt.e, vals[0])
+		}
+	}
+}
+
+func TestNotifyWithCallback(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+
+	// callback
+	s.MockCallback(gntp.CLICKED, gntp.NONE)
+	_, ch, err := c.NotifyWithCallback(context.Background(), &gntp.Notification{Name: "Name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cb, ok := <-ch; !ok {
+		t.Error("expected callback")
+	} else if cb.Result != gntp.CLICKED {
+		t.Errorf("expected %v, got %v", gntp.CLICKED, cb.Result)
+	}
+	if _, ok := <-ch; ok {
+		t.Error("expected closed channel")
+	}
+	select {
+	case cb := <-c.Callback:
+		t.Errorf("unexpected callback: %#v", cb)
+	default:
+	}
+	// connection ends
+	s.MockOK("NOTIFY", gntp.NONE)
+	_, ch, err = c.NotifyWithCallback(context.Background(), &gntp.Notification{Name: "Name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cb, ok := <-ch; ok {
+		t.Errorf("unexpected callback: %#v", cb)
+	}
+	// error
+	_, ch, err = c.NotifyWithCallback(context.Background(), &gntp.Notification{Name: "Name", CallbackTarget: "file:///"})
+	if err != gntp.ErrCallbackTarget {
+		t.Errorf("expected ErrCallbackTarget, got %#v", err)
+	}
+	if _, ok := <-ch; ok {
+		t.Error("expected closed channel")
+	}
+	s.MockError(gntp.UnknownNotification)
+	_, ch, err = c.NotifyWithCallback(context.Background(), &gntp.Notification{Name: "Name"})
+	if err == nil {
+		t.Error("expected error")
+	}
+	if _, ok := <-ch; ok {
+		t.Error("expected closed channel")
+	}
+	c.Wait()
+}
+
+func TestResponseCancel(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+
+	release := make(chan struct{})
+	var resps []*gntp.Response
+	var chs []<-chan *gntp.Callback
+	for i := 0; i < 3; i++ {
+		s.MockEncryptedResponse(gntp.NONE, func(conn net.Conn, i *gntp.Info) {
+			s.OK(conn, i, "NOTIFY")
+			<-release
+			s.Callback(conn, i, gntp.CLICKED)
+		})
+		resp, ch, err := c.NotifyWithCallback(context.Background(), &gntp.Notification{Name: "Name"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resps = append(resps, resp)
+		chs = append(chs, ch)
+	}
+	resps[1].Cancel()
+	if cb, ok := <-chs[1]; ok {
+		t.Errorf("unexpected callback: %#v", cb)
+	}
+	close(release)
+	for _, i := range []int{0, 2} {
+		if cb, ok := <-chs[i]; !ok {
+			t.Error("expected callback")
+		} else if cb.Result != gntp.CLICKED {
+			t.Errorf("expected %v, got %v", gntp.CLICKED, cb.Result)
+		}
+	}
+	c.Wait()
+	// no connection
+	resps[1].Cancel()
+	(*gntp.Response)(nil).Cancel()
+}
+
+func TestCallbackTimeout(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+	c.CallbackTimeout = 100 * time.Millisecond
+
+	s.MockEncryptedResponse(gntp.NONE, func(conn net.Conn, i *gntp.Info) {
+		s.OK(conn, i, "NOTIFY")
+		// never send a callback
+		io.Copy(io.Discard, conn)
+	})
+	if _, err := c.Notify(&gntp.Notification{Name: "Name"}); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		c.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case cb := <-c.Callback:
+		t.Errorf("unexpected callback: %v", cb)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestNow(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+	c.Now = func() time.Time {
+		return now
+	}
+
+	// without timestamp
+	s.MockEncryptedResponse(gntp.NONE, func(conn net.Conn, i *gntp.Info) {
+		s.OK(conn, i, "NOTIFY")
+		io.WriteString(conn, "GNTP/1.0 -CALLBACK NONE\r\n")
+		io.WriteString(conn, "Notification-Callback-Result: CLICKED\r\n")
+		io.WriteString(conn, "\r\n")
+	})
+	if _, err := c.Notify(&gntp.Notification{Name: "Name"}); err != nil {
+		t.Fatal(err)
+	}
+	if cb := <-c.Callback; !cb.Timestamp.Equal(now) {
+		t.Errorf("expected %v, got %v", now, cb.Timestamp)
+	}
+	// with timestamp
+	s.MockCallback(gntp.CLICKED, gntp.NONE)
+	if _, err := c.Notify(&gntp.Notification{Name: "Name"}); err != nil {
+		t.Fatal(err)
+	}
+	if cb := <-c.Callback; cb.Timestamp.Equal(now) {
+		t.Errorf("expected the timestamp of the server, got %v", cb.Timestamp)
+	}
+	c.Wait()
+	// CallbackTimeout
+	c.CallbackTimeout = time.Hour
+	c.Now = func() time.Time {
+		return time.Now().Add(-2 * time.Hour)
+	}
+	s.MockEncryptedResponse(gntp.NONE, func(conn net.Conn, i *gntp.Info) {
+		s.OK(conn, i, "NOTIFY")
+		// never send a callback
+		io.Copy(io.Discard, conn)
+	})
+	if _, err := c.Notify(&gntp.Notification{Name: "Name"}); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		c.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case cb := <-c.Callback:
+		t.Errorf("unexpected callback: %v", cb)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	// without Now
+	c.Now = nil
+	c.CallbackTimeout = 0
+	s.MockEncryptedResponse(gntp.NONE, func(conn net.Conn, i *gntp.Info) {
+		s.OK(conn, i, "NOTIFY")
+		io.WriteString(conn, "GNTP/1.0 -CALLBACK NONE\r\n")
+		io.WriteString(conn, "Notification-Callback-Result: CLICKED\r\n")
+		io.WriteString(conn, "\r\n")
+	})
+	if _, err := c.Notify(&gntp.Notification{Name: "Name"}); err != nil {
+		t.Fatal(err)
+	}
+	if cb := <-c.Callback; !cb.Timestamp.IsZero() {
+		t.Errorf("expected zero, got %v", cb.Timestamp)
+	}
+	c.Wait()
+}
+
+func TestClose(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+
+	for i := 0; i < 10; i++ {
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := <-c.Callback; ok {
+		t.Error("expected closed channel")
+	}
+	// socket callback is not waited
+	s.MockCallback(gntp.CLICKED, gntp.NONE)
+	if _, err := c.Notify(&gntp.Notification{Name: "Name"}); err != nil {
+		t.Error(err)
+	}
+	c.Wait()
+}
+
+func TestTLS(t *testing.T) {
+	cert, pool := NewCertificate("127.0.0.1", "localhost")
+	s := NewTLSServer(cert)
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+
+	// unknown authority
+	c.TLSConfig = new(tls.Config)
+	if _, err := c.Register(nil); err == nil {
+		t.Error("expected error")
+	}
+	// hostname mismatch
+	c.TLSConfig = &tls.Config{
+		RootCAs:    pool,
+		ServerName: "example.com",
+	}
+	if _, err := c.Register(nil); err == nil {
+		t.Error("expected error")
+	}
+	// insecure
+	c.TLSConfig = &tls.Config{
+		InsecureSkipVerify: true,
+		ServerName:         "example.com",
+	}
+	s.MockOK("REGISTER", gntp.NONE)
+	if _, err := c.Register(nil); err != nil {
+		t.Error(err)
+	}
+	// verified
+	c.TLSConfig = &tls.Config{RootCAs: pool}
+	s.MockOK("REGISTER", gntp.NONE)
+	if _, err := c.Register(nil); err != nil {
+		t.Error(err)
+	}
+	if c.TLSConfig.ServerName != "" {
+		t.Error("TLSConfig is modified")
+	}
+	s.MockCallback(gntp.CLICKED, gntp.NONE)
+	if _, err := c.Notify(&gntp.Notification{Name: "Name"}); err != nil {
+		t.Fatal(err)
+	}
+	if cb := <-c.Callback; cb.Result != gntp.CLICKED {
+		t.Errorf("expected %v, got %v", gntp.CLICKED, cb.Result)
+	}
+	// invalid server
+	c.Server = "localhost"
+	if _, err := c.Register(nil); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestPinnedCertificates(t *testing.T) {
+	cert, _ := NewCertificate("127.0.0.1", "localhost")
+	s := NewTLSServer(cert)
 	defer s.Close()
 
 	c := gntp.New()
 	c.Server = s.Addr
 	c.Name = name
 
-	s.MockOK("REGISTER", gntp.NONE)
-	_, err := c.Register([]*gntp.Notification{
-		{
-			Name:    "Name",
-			Enabled: true,
-		},
-	})
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	// unsupported icon
-	_, err = c.Notify(&gntp.Notification{
-		Name:  "Name",
-		Title: "Title",
-		Text:  "Text",
-		Icon:  0,
-	})
-	if err == nil {
-		t.Error("expected error")
+	// not matched
+	c.PinnedCertificates = [][sha256.Size]byte{sha256.Sum256([]byte("certificate"))}
+	if _, err := c.Register(nil); !errors.Is(err, gntp.ErrCertificate) {
+		t.Errorf("expected ErrCertificate, got %#v", err)
 	}
-	// image error
-	for _, img := range []image.Image{
-		image.NewAlpha(image.Rect(0, 0, 32, 32)),
-		image.NewGray(image.Rect(0, 0, 0, 0)),
-	} {
-		_, err = c.Notify(&gntp.Notification{
-			Name:  "Name",
-			Title: "Title",
-			Text:  "Text",
-			Icon:  img,
-		})
-		if err == nil {
-			t.Error("expected error")
-		}
+	// matched
+	c.PinnedCertificates = append(c.PinnedCertificates, sha256.Sum256(cert.Certificate[0]))
+	s.MockOK("REGISTER", gntp.NONE)
+	if _, err := c.Register(nil); err != nil {
+		t.Error(err)
 	}
-	// read error
-	_, err = c.Notify(&gntp.Notification{
-		Name:  "Name",
-		Title: "Title",
-		Text:  "Text",
-		Icon:  new(reader),
-	})
-	if err != io.ErrUnexpectedEOF {
-		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	// with TLSConfig
+	c.TLSConfig = &tls.Config{ServerName: "example.com"}
+	s.MockOK("REGISTER", gntp.NONE)
+	if _, err := c.Register(nil); err != nil {
+		t.Error(err)
 	}
-	c.Header["X-Header"] = new(reader)
-	_, err = c.Notify(&gntp.Notification{
-		Name:  "Name",
-		Title: "Title",
-		Text:  "Text",
-	})
-	if err != io.ErrUnexpectedEOF {
-		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	if c.TLSConfig.InsecureSkipVerify || c.TLSConfig.VerifyPeerCertificate != nil {
+		t.Error("TLSConfig is modified")
 	}
-	delete(c.Header, "X-Header")
-	// unknown hash algorithm
-	c.HashAlgorithm = -1
-	_, err = c.Notify(&gntp.Notification{
-		Name:  "Name",
-		Title: "Title",
-		Text:  "Text",
-		Icon:  []byte("[]byte"),
-	})
-	if err != gntp.ErrHash {
-		t.Errorf("expected ErrHash, got %v", err)
+	// UDP
+	c.Network = "udp"
+	if _, err := c.Register(nil); err != gntp.ErrNetwork {
+		t.Errorf("expected ErrNetwork, got %#v", err)
 	}
 }
 
-type reader struct {
-}
-
-func (r *reader) Read([]byte) (int, error) { return 0, io.ErrUnexpectedEOF }
+func TestDialer(t *testing.T) {
+	var n atomic.Int32
+	d := &net.Dialer{
+		Control: func(network, address string, c syscall.RawConn) error {
+			n.Add(1)
+			return nil
+		},
+	}
 
-func TestCallback(t *testing.T) {
+	// request and callback
 	s := NewServer()
 	defer s.Close()
 
 	c := gntp.New()
 	c.Server = s.Addr
 	c.Name = name
+	c.Dialer = d
 
 	s.MockOK("REGISTER", gntp.NONE)
-	_, err := c.Register([]*gntp.Notification{
-		{
-			Name:    "Name",
-			Enabled: true,
-		},
-	})
+	if _, err := c.Register(nil); err != nil {
+		t.Fatal(err)
+	}
+	s.MockCallback(gntp.CLICKED, gntp.NONE)
+	if _, err := c.Notify(&gntp.Notification{Name: "Name"}); err != nil {
+		t.Fatal(err)
+	}
+	if cb := <-c.Callback; cb.Result != gntp.CLICKED {
+		t.Errorf("expected %v, got %v", gntp.CLICKED, cb.Result)
+	}
+	if g, e := n.Load(), int32(2); g != e {
+		t.Errorf("expected %v dials, got %v", e, g)
+	}
+	// TLS
+	cert, pool := NewCertificate("127.0.0.1", "localhost")
+	ts := NewTLSServer(cert)
+	defer ts.Close()
+
+	c.Server = ts.Addr
+	c.TLSConfig = &tls.Config{RootCAs: pool}
+	ts.MockOK("REGISTER", gntp.NONE)
+	if _, err := c.Register(nil); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := n.Load(), int32(3); g != e {
+		t.Errorf("expected %v dials, got %v", e, g)
+	}
+	// UDP
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer pc.Close()
 
-	for _, ea := range []gntp.EncryptionAlgorithm{
-		gntp.NONE,
-		gntp.DES,
-		gntp.TDES,
-		gntp.AES,
+	c.Server = pc.LocalAddr().String()
+	c.TLSConfig = nil
+	c.Network = "udp"
+	if _, err := c.Notify(&gntp.Notification{Name: "Name"}); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := n.Load(), int32(4); g != e {
+		t.Errorf("expected %v dials, got %v", e, g)
+	}
+}
+
+func TestUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	c := gntp.New()
+	c.Server = pc.LocalAddr().String()
+	c.Name = name
+	c.Network = "udp"
+
+	n := &gntp.Notification{
+		Name:  "Name",
+		Title: "Title",
+		Text:  "Text",
+	}
+	resp, err := c.Notify(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != nil {
+		t.Errorf("expected nil, got %#v", resp)
+	}
+	pc.SetReadDeadline(time.Now().Add(3 * time.Second))
+	b := make([]byte, 64<<10)
+	l, _, err := pc.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := string(b[:l])
+	if !strings.HasPrefix(req, "GNTP/1.0 NOTIFY NONE\r\n") {
+		t.Errorf("unexpected request: %q", req)
+	}
+	for _, s := range []string{
+		"Application-Name: " + name + "\r\n",
+		"Notification-Name: Name\r\n",
+		"Notification-Title: Title\r\n",
+		"Notification-Text: Text\r\n",
 	} {
-		for i := 0; i < 10; i++ {
-			if ea != gntp.NONE {
-				s.SetPassword(password)
-				c.Password = password
-			} else {
-				s.SetPassword("")
-				c.Password = ""
-			}
-			res := gntp.Result((i % 3) + 1)
-			s.MockCallback(res, ea)
-			_, err := c.Notify(&gntp.Notification{
-				Name:                "Name",
-				CallbackContext:     strconv.Itoa(i),
-				CallbackContextType: "int",
-			})
-			if err != nil {
-				t.Error(err)
-			} else if g := <-c.Callback; g.Result != res {
-				t.Errorf("expected %v, got %v", res, g.Result)
-			}
+		if !strings.Contains(req, s) {
+			t.Errorf("expected %q in %q", s, req)
 		}
 	}
+	if !strings.HasSuffix(req, "\r\n\r\n") {
+		t.Errorf("unexpected request: %q", req)
+	}
 
-	s.MockCallback(gntp.TIMEOUT, gntp.NONE)
-	if _, err := c.Notify(new(gntp.Notification)); err != nil {
-		t.Error(err)
+	// TLS
+	c.TLSConfig = new(tls.Config)
+	if _, err := c.Notify(n); err != gntp.ErrNetwork {
+		t.Errorf("expected ErrNetwork, got %#v", err)
+	}
+	// unknown network
+	c.TLSConfig = nil
+	c.Network = "unix"
+	if _, err := c.Notify(n); err != gntp.ErrNetwork {
+		t.Errorf("expected ErrNetwork, got %#v", err)
 	}
-	time.Sleep(time.Microsecond)
-	c.Reset()
-	c.Wait()
 }
 
 func TestCallbackError(t *testing.T) {
@@ -546,7 +1852,7 @@ func TestCallbackError(t *testing.T) {
 
 		io.WriteString(conn, "GNTP/1.0 _ NONE\r\n\r\n")
 	})
-	if _, err := c.Notify(new(gntp.Notification)); err != nil {
+	if _, err := c.Notify(&gntp.Notification{Name: "Name"}); err != nil {
 		t.Error(err)
 	}
 	s.MockEncryptedResponse(gntp.NONE, func(conn net.Conn, i *gntp.Info) {
@@ -554,7 +1860,7 @@ func TestCallbackError(t *testing.T) {
 
 		io.WriteString(conn, "GNTP/1.0 -OK NONE\r\n\r\n")
 	})
-	if _, err := c.Notify(new(gntp.Notification)); err != nil {
+	if _, err := c.Notify(&gntp.Notification{Name: "Name"}); err != nil {
 		t.Error(err)
 	}
 	s.MockEncryptedResponse(gntp.NONE, func(conn net.Conn, i *gntp.Info) {
@@ -565,7 +1871,7 @@ func TestCallbackError(t *testing.T) {
 		fmt.Fprintf(conn, "%v\r\n", i)
 		io.WriteString(conn, "Application-Name\r\n\r\n")
 	})
-	if _, err := c.Notify(new(gntp.Notification)); err != nil {
+	if _, err := c.Notify(&gntp.Notification{Name: "Name"}); err != nil {
 		t.Error(err)
 	}
 	// invalid -CALLBACK response (encrypted)
@@ -576,7 +1882,7 @@ func TestCallbackError(t *testing.T) {
 
 		fmt.Fprintf(conn, "%v\r\n", i)
 	})
-	if _, err := c.Notify(new(gntp.Notification)); err != nil {
+	if _, err := c.Notify(&gntp.Notification{Name: "Name"}); err != nil {
 		t.Error(err)
 	}
 	s.MockEncryptedResponse(gntp.AES, func(conn net.Conn, i *gntp.Info) {
@@ -593,13 +1899,46 @@ func TestCallbackError(t *testing.T) {
 		conn.Write(encrypt(i, src))
 		io.WriteString(conn, "\r\n\r\n")
 	})
-	if _, err := c.Notify(new(gntp.Notification)); err != nil {
+	if _, err := c.Notify(&gntp.Notification{Name: "Name"}); err != nil {
 		t.Error(err)
 	}
 
 	c.Wait()
 }
 
+func TestMaxResponseSize(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+	c.MaxResponseSize = 1024
+
+	s.MockOK("REGISTER", gntp.NONE)
+	if _, err := c.Register(nil); err != nil {
+		t.Fatal(err)
+	}
+	s.MockResponse(func(conn net.Conn) {
+		io.WriteString(conn, "GNTP/1.0 -OK NONE\r\n")
+		for i := 0; i < 1024; i++ {
+			fmt.Fprintf(conn, "X-Header-%v: %v\r\n", i, strings.Repeat("*", 64))
+		}
+		io.WriteString(conn, "\r\n")
+	})
+	if _, err := c.Register(nil); err != gntp.ErrResponseSize {
+		t.Errorf("expected ErrResponseSize, got %v", err)
+	}
+	// socket callback
+	s.MockCallback(gntp.CLICKED, gntp.NONE)
+	if _, err := c.Notify(&gntp.Notification{Name: "Name"}); err != nil {
+		t.Fatal(err)
+	}
+	if cb := <-c.Callback; cb.Result != gntp.CLICKED {
+		t.Errorf("expected %v, got %v", gntp.CLICKED, cb.Result)
+	}
+}
+
 func TestRequestError(t *testing.T) {
 	s := NewServer()
 	defer s.Close()
@@ -818,6 +2157,88 @@ func TestInfo(t *testing.T) {
 	}
 }
 
+func TestVerifyPassword(t *testing.T) {
+	for _, l := range []string{
+		"GNTP/1.0 REGISTER NONE MD5:B80A1CD3F719006F932A3FAAC90FEEA5.0123456789",
+		"GNTP/1.0 REGISTER NONE SHA1:926D135D821E07CD720E63FAB2629887E67A3601.0123456789",
+		"GNTP/1.0 REGISTER NONE SHA256:CF0D52E2716F54C0EA9D6BAD563F1E1C7C46122BE8BE9FB1A09587D064C723C7.0123456789",
+		"GNTP/1.0 REGISTER NONE SHA512:710F213B1F8E97C5BF04089367B4AE08BBDF82285557B4986E3170A3F214165B6320E4C63A8A55A6BD31652FEB9B17B8191B2884AE76D36AFEBF72298B982511.0123456789",
+		"GNTP/1.0 REGISTER DES:0011223344556677 MD5:B80A1CD3F719006F932A3FAAC90FEEA5.0123456789",
+		"GNTP/1.0 REGISTER 3DES:0011223344556677 SHA256:CF0D52E2716F54C0EA9D6BAD563F1E1C7C46122BE8BE9FB1A09587D064C723C7.0123456789",
+		"GNTP/1.0 REGISTER AES:00112233445566778899AABBCCDDEEFF SHA256:CF0D52E2716F54C0EA9D6BAD563F1E1C7C46122BE8BE9FB1A09587D064C723C7.0123456789",
+	} {
+		switch ok, err := gntp.VerifyPassword(l, password); {
+		case err != nil:
+			t.Error(err)
+		case !ok:
+			t.Errorf("%q: expected true", l)
+		}
+		switch ok, err := gntp.VerifyPassword(l, "incorrect"); {
+		case err != nil:
+			t.Error(err)
+		case ok:
+			t.Errorf("%q: expected false", l)
+		}
+	}
+	// no key hash
+	l := "GNTP/1.0 REGISTER NONE"
+	for _, tt := range []struct {
+		password string
+		ok       bool
+	}{
+		{"", true},
+		{password, false},
+	} {
+		switch ok, err := gntp.VerifyPassword(l, tt.password); {
+		case err != nil:
+			t.Error(err)
+		case ok != tt.ok:
+			t.Errorf("%q: expected %v, got %v", tt.password, tt.ok, ok)
+		}
+	}
+	// error
+	for _, l := range []string{
+		"",
+		"GNTP/1.0 _ NONE",
+		"GNTP/1.0 REGISTER NONE MD5:_._",
+		"GNTP/1.0 REGISTER NONE SHA224:D674BB58EDC717D2E44413AB45D8570C4922D6DA732788C166114D87.0123456789",
+	} {
+		if _, err := gntp.VerifyPassword(l, password); err == nil {
+			t.Errorf("%q: expected error", l)
+		}
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	salt, _ := hex.DecodeString("0123456789")
+	for _, tt := range []struct {
+		ha      gntp.HashAlgorithm
+		keyHash string
+	}{
+		{gntp.MD5, "B80A1CD3F719006F932A3FAAC90FEEA5"},
+		{gntp.SHA1, "926D135D821E07CD720E63FAB2629887E67A3601"},
+		{gntp.SHA256, "CF0D52E2716F54C0EA9D6BAD563F1E1C7C46122BE8BE9FB1A09587D064C723C7"},
+		{gntp.SHA512, "710F213B1F8E97C5BF04089367B4AE08BBDF82285557B4986E3170A3F214165B6320E4C63A8A55A6BD31652FEB9B17B8191B2884AE76D36AFEBF72298B982511"},
+	} {
+		key, keyHash, err := gntp.DeriveKey(tt.ha, password, salt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, e := fmt.Sprintf("%X", keyHash), tt.keyHash; g != e {
+			t.Errorf("%v: keyHash = %v, expected %v", tt.ha, g, e)
+		}
+		h, _ := tt.ha.New()
+		h.Write(key)
+		if !bytes.Equal(h.Sum(nil), keyHash) {
+			t.Errorf("%v: keyHash is not the hash of key", tt.ha)
+		}
+	}
+	// error
+	if _, _, err := gntp.DeriveKey(-1, password, salt); err != gntp.ErrHash {
+		t.Errorf("expected ErrHash, got %v", err)
+	}
+}
+
 func TestDecrypt(t *testing.T) {
 	e := []byte("data")
 	i := &gntp.Info{
@@ -881,6 +2302,46 @@ func TestEncrypt(t *testing.T) {
 	}
 }
 
+func TestRoundTrip(t *testing.T) {
+	e := []byte("data")
+	for _, tt := range []struct {
+		ea  gntp.EncryptionAlgorithm
+		ha  gntp.HashAlgorithm
+		err error
+	}{
+		{gntp.NONE, gntp.MD5, nil},
+		{gntp.DES, gntp.MD5, nil},
+		{gntp.DES, gntp.SHA1, nil},
+		{gntp.TDES, gntp.MD5, gntp.ErrKeyLength},
+		{gntp.TDES, gntp.SHA256, nil},
+		{gntp.TDES, gntp.SHA512, nil},
+		{gntp.AES, gntp.SHA1, gntp.ErrKeyLength},
+		{gntp.AES, gntp.SHA256, nil},
+		{gntp.AES, gntp.SHA512, nil},
+		{gntp.AES, -1, gntp.ErrHash},
+		{-1, gntp.SHA256, gntp.ErrEncryption},
+	} {
+		for _, s := range []string{"", password} {
+			enc, g, err := gntp.RoundTrip(tt.ea, tt.ha, s, e)
+			switch {
+			case s == "":
+				if err != nil {
+					t.Errorf("%v/%v: %v", tt.ea, tt.ha, err)
+				} else if !reflect.DeepEqual(enc, e) {
+					t.Errorf("%v/%v: expected plain text, got %v", tt.ea, tt.ha, enc)
+				}
+			case err != tt.err:
+				t.Errorf("%v/%v: expected %v, got %v", tt.ea, tt.ha, tt.err, err)
+			case err != nil:
+			case tt.ea != gntp.NONE && (len(enc) == 0 || reflect.DeepEqual(enc, e)):
+				t.Errorf("%v/%v: not encrypted: %v", tt.ea, tt.ha, enc)
+			case !reflect.DeepEqual(g, e):
+				t.Errorf("%v/%v: expected %v, got %v", tt.ea, tt.ha, e, g)
+			}
+		}
+	}
+}
+
 func TestHashAlgorithm(t *testing.T) {
 	for i, e := range []string{
 		"MD5",
@@ -906,6 +2367,59 @@ func TestHashAlgorithm(t *testing.T) {
 	}
 }
 
+func TestParseHashAlgorithm(t *testing.T) {
+	for _, tt := range []struct {
+		s  string
+		ha gntp.HashAlgorithm
+	}{
+		{"MD5", gntp.MD5},
+		{"sha1", gntp.SHA1},
+		{"Sha256", gntp.SHA256},
+		{"SHA512", gntp.SHA512},
+	} {
+		ha, err := gntp.ParseHashAlgorithm(tt.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ha != tt.ha {
+			t.Errorf("ParseHashAlgorithm(%q) = %v, expected %v", tt.s, ha, tt.ha)
+		}
+	}
+	// error
+	for _, s := range []string{"", "SHA-256", "NONE"} {
+		if _, err := gntp.ParseHashAlgorithm(s); err != gntp.ErrHash {
+			t.Errorf("%q: expected ErrHash, got %#v", s, err)
+		}
+	}
+}
+
+func TestParseEncryptionAlgorithm(t *testing.T) {
+	for _, tt := range []struct {
+		s  string
+		ea gntp.EncryptionAlgorithm
+	}{
+		{"NONE", gntp.NONE},
+		{"des", gntp.DES},
+		{"3DES", gntp.TDES},
+		{"tdes", gntp.TDES},
+		{"Aes", gntp.AES},
+	} {
+		ea, err := gntp.ParseEncryptionAlgorithm(tt.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ea != tt.ea {
+			t.Errorf("ParseEncryptionAlgorithm(%q) = %v, expected %v", tt.s, ea, tt.ea)
+		}
+	}
+	// error
+	for _, s := range []string{"", "AES-256", "MD5"} {
+		if _, err := gntp.ParseEncryptionAlgorithm(s); err != gntp.ErrEncryption {
+			t.Errorf("%q: expected ErrEncryption, got %#v", s, err)
+		}
+	}
+}
+
 func TestEncryptionAlgorithm(t *testing.T) {
 	salt := make([]byte, 16)
 	if _, err := rand.Read(salt); err != nil {
@@ -957,6 +2471,12 @@ func TestError(t *testing.T) {
 	if g, e := err.Error(), code.Description(); g != e {
 		t.Errorf("Error.Error() = %q, expected %q", g, e)
 	}
+
+	code = 999
+	err = gntp.Error{Code: code}
+	if g, e := err.Error(), "Unknown Error (999)"; g != e {
+		t.Errorf("Error.Error() = %q, expected %q", g, e)
+	}
 }
 
 func TestResult(t *testing.T) {
@@ -1,7 +1,7 @@
 //
 // go.notify/gntp :: impl.go
 //
-//   Copyright (c) 2017-2019 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2017-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -9,15 +9,27 @@
 package gntp
 
 import (
+	"context"
 	"fmt"
+	"image"
+	"io"
 	"math"
+	"sort"
 
 	"github.com/hattya/go.notify"
 )
 
 type notifier struct {
-	c  *Client
-	ev map[string]*Notification
+	c       *Client
+	ev      map[string]*Notification
+	sec     map[string]security
+	lenient bool
+}
+
+// security represents the algorithms for the NOTIFY requests of an event.
+type security struct {
+	ha HashAlgorithm
+	ea EncryptionAlgorithm
 }
 
 // NewNotifier returns a new Notifier.
@@ -28,40 +40,100 @@ type notifier struct {
 //   - image.Image
 //   - io.Reader
 //
+// An io.Reader icon is read at the time of Register, and the data is sent
+// for each request. So are the io.Reader values of gntp:header, which is
+// copied at the time of Register.
+//
 // Register accepts following keys and values types:
 //   - gntp:display-name string
 //   - gntp:enabled      bool
+//   - gntp:header       map[string]interface{}
 //   - gntp:sticky       bool
 //   - gntp:priority     int
+//   - gntp:hash         string
+//     This is parsed by ParseHashAlgorithm, and used instead of the
+//     HashAlgorithm of the Client for the NOTIFY requests of the event.
+//   - gntp:encryption   string
+//     This is parsed by ParseEncryptionAlgorithm, and used instead of the
+//     EncryptionAlgorithm of the Client for the NOTIFY requests of the
+//     event.
+//
+// The REGISTER requests, which contain all the registered events, always use
+// the algorithms of the Client. If only one of gntp:hash and gntp:encryption
+// is specified, the other is the one of the Client at the time of Register.
+//
+// The returned Notifier also has the following methods:
+//
+//	// NotifyContext is like Notify but bounds the NOTIFY request by the context.
+//	NotifyContext(ctx context.Context, event, title, body string) error
+//	// RegisteredEvents returns the sorted names of the registered events.
+//	RegisteredEvents() []string
+//	// Unregister removes the event, and sends a REGISTER request with the
+//	// remaining events.
+//	Unregister(event string) error
+//	// SetLenient specifies whether Notify sends a NOTIFY request for the
+//	// unregistered event instead of returning notify.ErrEvent. It is for
+//	// servers which register the event on the first NOTIFY request.
+//	SetLenient(lenient bool)
 func NewNotifier(c *Client) notify.Notifier {
 	if c == nil {
 		c = New()
 	}
 	return &notifier{
-		c:  c,
-		ev: make(map[string]*Notification),
+		c:   c,
+		ev:  make(map[string]*Notification),
+		sec: make(map[string]security),
 	}
 }
 
 func (p *notifier) Close() error {
-	p.c.Reset()
-	return nil
+	return p.c.Close()
 }
 
 func (p *notifier) Notify(event, title, body string) error {
-	n := new(Notification)
+	return p.NotifyContext(context.Background(), event, title, body)
+}
+
+func (p *notifier) NotifyContext(ctx context.Context, event, title, body string) error {
+	var n *Notification
 	if ev, ok := p.ev[event]; ok {
-		*n = *ev
+		n = ev.Clone()
+	} else if p.lenient {
+		n = &Notification{Name: event}
 	} else {
 		return notify.ErrEvent
 	}
 	n.Title = title
 	n.Text = body
-	_, err := p.c.Notify(n)
+	if sec, ok := p.sec[event]; ok {
+		b, err := p.c.notifyBuffer(n, nil)
+		if err != nil {
+			return err
+		}
+		_, err = p.c.do(ctx, "NOTIFY", func(w io.Writer) error {
+			return p.c.encodeWith(w, "NOTIFY", sec.ha, sec.ea, b)
+		}, nil)
+		return err
+	}
+	_, err := p.c.NotifyContext(ctx, n)
 	return err
 }
 
+func (p *notifier) SetLenient(lenient bool) {
+	p.lenient = lenient
+}
+
 func (p *notifier) Register(event string, icon notify.Icon, opts map[string]interface{}) error {
+	// buffered to send it for each request
+	switch r := icon.(type) {
+	case string, []byte, image.Image:
+	case io.Reader:
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		icon = b
+	}
 	n := &Notification{
 		Name:    event,
 		Enabled: true,
@@ -83,6 +155,28 @@ func (p *notifier) Register(event string, icon notify.Icon, opts map[string]inte
 			return fmt.Errorf("%q expects bool: %T", k, v)
 		}
 	}
+	k = "gntp:header"
+	if v, ok := opts[k]; ok {
+		if m, ok := v.(map[string]interface{}); ok {
+			n.Header = make(map[string]interface{}, len(m))
+			for k, v := range m {
+				switch r := v.(type) {
+				case []byte:
+					v = append([]byte{}, r...)
+				case io.Reader:
+					// buffered to send it for each request
+					b, err := io.ReadAll(r)
+					if err != nil {
+						return err
+					}
+					v = b
+				}
+				n.Header[k] = v
+			}
+		} else {
+			return fmt.Errorf("%q expects map[string]interface{}: %T", k, v)
+		}
+	}
 	k = "gntp:sticky"
 	if v, ok := opts[k]; ok {
 		if b, ok := v.(bool); ok {
@@ -136,8 +230,63 @@ func (p *notifier) Register(event string, icon notify.Icon, opts map[string]inte
 		}
 		n.Priority = i
 	}
+	sec := security{
+		ha: p.c.HashAlgorithm,
+		ea: p.c.EncryptionAlgorithm,
+	}
+	var secure bool
+	k = "gntp:hash"
+	if v, ok := opts[k]; ok {
+		secure = true
+		if s, ok := v.(string); ok {
+			var err error
+			if sec.ha, err = ParseHashAlgorithm(s); err != nil {
+				return fmt.Errorf("%q: %w", k, err)
+			}
+		} else {
+			return fmt.Errorf("%q expects string: %T", k, v)
+		}
+	}
+	k = "gntp:encryption"
+	if v, ok := opts[k]; ok {
+		secure = true
+		if s, ok := v.(string); ok {
+			var err error
+			if sec.ea, err = ParseEncryptionAlgorithm(s); err != nil {
+				return fmt.Errorf("%q: %w", k, err)
+			}
+		} else {
+			return fmt.Errorf("%q expects string: %T", k, v)
+		}
+	}
+	if secure {
+		p.sec[event] = sec
+	} else {
+		delete(p.sec, event)
+	}
 	p.ev[event] = n
+	return p.register()
+}
+
+func (p *notifier) Unregister(event string) error {
+	if _, ok := p.ev[event]; !ok {
+		return notify.ErrEvent
+	}
+	delete(p.ev, event)
+	delete(p.sec, event)
+	return p.register()
+}
+
+func (p *notifier) RegisteredEvents() []string {
+	list := make([]string, 0, len(p.ev))
+	for k := range p.ev {
+		list = append(list, k)
+	}
+	sort.Strings(list)
+	return list
+}
 
+func (p *notifier) register() error {
 	list := make([]*Notification, len(p.ev))
 	i := 0
 	for _, n := range p.ev {
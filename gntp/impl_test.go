@@ -1,7 +1,7 @@
 //
 // go.notify/gntp :: impl_test.go
 //
-//   Copyright (c) 2017-2019 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2017-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -9,9 +9,16 @@
 package gntp_test
 
 import (
+	"context"
+	"errors"
 	"math"
+	"net"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/hattya/go.notify"
 	"github.com/hattya/go.notify/gntp"
 )
 
@@ -37,6 +44,7 @@ func TestNotifierRegister(t *testing.T) {
 	for _, opts := range []map[string]interface{}{
 		{"gntp:display-name": "Display Name"},
 		{"gntp:enabled": true},
+		{"gntp:header": map[string]interface{}{"X-Header": "value"}},
 		{"gntp:sticky": true},
 		{"gntp:priority": int(1)},
 		{"gntp:priority": int8(1)},
@@ -58,6 +66,7 @@ func TestNotifierRegister(t *testing.T) {
 	for _, opts := range []map[string]interface{}{
 		{"gntp:display-name": nil},
 		{"gntp:enabled": nil},
+		{"gntp:header": nil},
 		{"gntp:sticky": nil},
 		{"gntp:priority": nil},
 		{"gntp:priority": int64(math.MaxInt32 + 1)},
@@ -72,6 +81,197 @@ func TestNotifierRegister(t *testing.T) {
 	}
 }
 
+func TestNotifierSecurity(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.SetPassword(password)
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+	c.Password = password
+	ha, ea := c.HashAlgorithm, c.EncryptionAlgorithm
+	n := gntp.NewNotifier(c)
+	defer n.Close()
+
+	opts := map[string]interface{}{
+		"gntp:hash":       "sha512",
+		"gntp:encryption": "aes",
+	}
+	s.MockOK("REGISTER", gntp.NONE)
+	if err := n.Register("event", nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	s.MockOK("REGISTER", gntp.NONE)
+	if err := n.Register("plain", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	i := s.LastRequest().Info
+	if i.HashAlgorithm != ha || i.EncryptionAlgorithm != ea {
+		t.Errorf("REGISTER: expected %v and %v, got %v and %v", ha, ea, i.HashAlgorithm, i.EncryptionAlgorithm)
+	}
+	for _, tt := range []struct {
+		event string
+		ha    gntp.HashAlgorithm
+		ea    gntp.EncryptionAlgorithm
+	}{
+		{"event", gntp.SHA512, gntp.AES},
+		{"plain", ha, ea},
+		{"event", gntp.SHA512, gntp.AES},
+	} {
+		s.MockOK("NOTIFY", tt.ea)
+		if err := n.Notify(tt.event, "Title", "Body"); err != nil {
+			t.Fatal(err)
+		}
+		i := s.LastRequest().Info
+		if i.HashAlgorithm != tt.ha || i.EncryptionAlgorithm != tt.ea {
+			t.Errorf("%v: expected %v and %v, got %v and %v", tt.event, tt.ha, tt.ea, i.HashAlgorithm, i.EncryptionAlgorithm)
+		}
+	}
+	// error
+	for _, opts := range []map[string]interface{}{
+		{"gntp:hash": "SHA-256"},
+		{"gntp:hash": 1},
+		{"gntp:encryption": "AES-256"},
+		{"gntp:encryption": 1},
+		{"gntp:hash": "SHA1", "gntp:encryption": "BLOWFISH"},
+	} {
+		if err := n.Register("event", nil, opts); err == nil {
+			t.Errorf("%v: expected error", opts)
+		}
+	}
+	if c.HashAlgorithm != ha || c.EncryptionAlgorithm != ea {
+		t.Errorf("Client is modified: %v, %v", c.HashAlgorithm, c.EncryptionAlgorithm)
+	}
+}
+
+func TestNotifierUnregister(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+	n := gntp.NewNotifier(c).(interface {
+		notify.Notifier
+		RegisteredEvents() []string
+		Unregister(string) error
+	})
+	defer n.Close()
+
+	if g := n.RegisteredEvents(); len(g) != 0 {
+		t.Errorf("expected empty, got %v", g)
+	}
+	for _, ev := range []string{"b", "c", "a"} {
+		s.MockOK("REGISTER", gntp.NONE)
+		if err := n.Register(ev, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if g, e := n.RegisteredEvents(), []string{"a", "b", "c"}; !reflect.DeepEqual(g, e) {
+		t.Errorf("RegisteredEvents() = %v, expected %v", g, e)
+	}
+	s.MockOK("REGISTER", gntp.NONE)
+	if err := n.Unregister("b"); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := n.RegisteredEvents(), []string{"a", "c"}; !reflect.DeepEqual(g, e) {
+		t.Errorf("RegisteredEvents() = %v, expected %v", g, e)
+	}
+	if err := n.Notify("b", "Title", "Body"); err != notify.ErrEvent {
+		t.Errorf("expected ErrEvent, got %v", err)
+	}
+	// unknown event
+	if err := n.Unregister("b"); err != notify.ErrEvent {
+		t.Errorf("expected ErrEvent, got %v", err)
+	}
+}
+
+func TestNotifierHeader(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+	c.Header["X-App"] = "client"
+	c.Header["X-Client"] = "client"
+	n := gntp.NewNotifier(c)
+	defer n.Close()
+
+	opts := map[string]interface{}{
+		"gntp:header": map[string]interface{}{
+			"x-app":       "event",
+			"X-Deep-Link": "app://event",
+		},
+	}
+	s.MockOK("REGISTER", gntp.NONE)
+	if err := n.Register("event", nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	req := s.LastRequest()
+	if g, e := req.Header.Get("X-App"), "client"; g != e {
+		t.Errorf("REGISTER: X-App = %q, expected %q", g, e)
+	}
+	if g, e := req.Notifications[0].Get("X-Deep-Link"), "app://event"; g != e {
+		t.Errorf("REGISTER: X-Deep-Link = %q, expected %q", g, e)
+	}
+
+	s.MockOK("NOTIFY", gntp.NONE)
+	if err := n.Notify("event", "Title", "Body"); err != nil {
+		t.Fatal(err)
+	}
+	req = s.LastRequest()
+	for k, e := range map[string]string{
+		"X-App":       "event",
+		"X-Client":    "client",
+		"X-Deep-Link": "app://event",
+	} {
+		if g := req.Header.Values(k); len(g) != 1 || g[0] != e {
+			t.Errorf("NOTIFY: %v = %q, expected %q", k, g, e)
+		}
+	}
+}
+
+func TestNotifierHeaderReader(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+	n := gntp.NewNotifier(c)
+	defer n.Close()
+
+	hdr := map[string]interface{}{
+		"X-Data": strings.NewReader("data"),
+	}
+	s.MockOK("REGISTER", gntp.NONE)
+	if err := n.Register("event", nil, map[string]interface{}{"gntp:header": hdr}); err != nil {
+		t.Fatal(err)
+	}
+	// changes by the caller do not affect the event
+	hdr["X-Data"] = "changed"
+	hdr["X-Added"] = "added"
+	for i := 0; i < 2; i++ {
+		s.MockOK("NOTIFY", gntp.NONE)
+		if err := n.Notify("event", "Title", "Body"); err != nil {
+			t.Fatal(err)
+		}
+		req := s.LastRequest()
+		id, ok := strings.CutPrefix(req.Header.Get("X-Data"), gntp.ResourceScheme)
+		if !ok {
+			t.Fatalf("expected resource, got %q", req.Header.Get("X-Data"))
+		}
+		if g, e := string(req.Resources[id]), "data"; g != e {
+			t.Errorf("expected %q, got %q", e, g)
+		}
+		if g := req.Header.Get("X-Added"); g != "" {
+			t.Errorf("unexpected X-Added: %q", g)
+		}
+	}
+}
+
 func TestNotifierNotify(t *testing.T) {
 	s := NewServer()
 	defer s.Close()
@@ -98,3 +298,144 @@ func TestNotifierNotify(t *testing.T) {
 	c = n.Sys().(*gntp.Client)
 	c.Wait()
 }
+
+func TestNotifierReaderIcon(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+	n := gntp.NewNotifier(c)
+	defer n.Close()
+
+	s.MockOK("REGISTER", gntp.NONE)
+	if err := n.Register("event", strings.NewReader("icon"), nil); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		s.MockOK("NOTIFY", gntp.NONE)
+		if err := n.Notify("event", "Title", "Body"); err != nil {
+			t.Fatal(err)
+		}
+		req := s.LastRequest()
+		id, ok := strings.CutPrefix(req.Header.Get("Notification-Icon"), gntp.ResourceScheme)
+		if !ok {
+			t.Fatalf("unexpected icon: %q", req.Header.Get("Notification-Icon"))
+		}
+		if g, e := string(req.Resources[id]), "icon"; g != e {
+			t.Errorf("expected %q, got %q", e, g)
+		}
+	}
+	// error
+	if err := n.Register("event", new(reader), nil); err == nil {
+		t.Error("expected error")
+	}
+
+	c = n.Sys().(*gntp.Client)
+	c.Wait()
+}
+
+func TestNotifierNotifyContext(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+	n := gntp.NewNotifier(c).(interface {
+		notify.Notifier
+		NotifyContext(context.Context, string, string, string) error
+	})
+	defer n.Close()
+
+	s.MockOK("REGISTER", gntp.NONE)
+	if err := n.Register("event", "path", nil); err != nil {
+		t.Fatal(err)
+	}
+	s.MockOK("NOTIFY", gntp.NONE)
+	if err := n.NotifyContext(context.Background(), "event", "Title", "Body"); err != nil {
+		t.Fatal(err)
+	}
+	// cancelled
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Server = l.Addr().String()
+	l.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := n.NotifyContext(ctx, "event", "Title", "Body"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	// unknown event
+	if err := n.NotifyContext(context.Background(), "", "Title", "Body"); err != notify.ErrEvent {
+		t.Errorf("expected ErrEvent, got %v", err)
+	}
+}
+
+func TestNotifierLenient(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+	n := gntp.NewNotifier(c).(interface {
+		notify.Notifier
+		SetLenient(bool)
+	})
+	defer n.Close()
+
+	if err := n.Notify("event", "Title", "Body"); err != notify.ErrEvent {
+		t.Errorf("expected ErrEvent, got %v", err)
+	}
+	n.SetLenient(true)
+	s.MockOK("NOTIFY", gntp.NONE)
+	if err := n.Notify("event", "Title", "Body"); err != nil {
+		t.Fatal(err)
+	}
+	req := s.LastRequest()
+	if g, e := req.Info.MessageType, "NOTIFY"; g != e {
+		t.Errorf("message type = %v, expected %v", g, e)
+	}
+	if g, e := req.Header.Get("Notification-Name"), "event"; g != e {
+		t.Errorf("Notification-Name = %v, expected %v", g, e)
+	}
+}
+
+func TestNotifierClose(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+	n := gntp.NewNotifier(c)
+
+	s.MockOK("REGISTER", gntp.NONE)
+	if err := n.Register("event", "path", nil); err != nil {
+		t.Fatal(err)
+	}
+	s.MockCallback(gntp.CLICKED, gntp.NONE)
+	if err := n.Notify("event", "Title", "Body"); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for range c.Callback {
+		}
+	}()
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout")
+	}
+}
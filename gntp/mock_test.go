@@ -1,7 +1,7 @@
 //
 // go.notify/gntp :: mock_test.go
 //
-//   Copyright (c) 2017-2020 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2017-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -11,8 +11,15 @@ package gntp_test
 import (
 	"bufio"
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
 	"io"
+	"math/big"
 	"net"
 	"net/textproto"
 	"strconv"
@@ -30,17 +37,38 @@ type Server struct {
 	l  net.Listener
 	wg sync.WaitGroup
 
-	mu       sync.Mutex
-	password string
-	handlers []func(net.Conn)
-	done     chan struct{}
+	mu        sync.Mutex
+	password  string
+	keepAlive bool
+	handlers  []func(net.Conn)
+	last      *Request
+	n         int
+	done      chan struct{}
+}
+
+type Request struct {
+	Info          *gntp.Info
+	Header        textproto.MIMEHeader
+	Notifications []textproto.MIMEHeader
+	Resources     map[string][]byte
 }
 
 func NewServer() *Server {
+	return newServer(nil)
+}
+
+func NewTLSServer(cert tls.Certificate) *Server {
+	return newServer(&tls.Config{Certificates: []tls.Certificate{cert}})
+}
+
+func newServer(config *tls.Config) *Server {
 	l, err := net.Listen("tcp", "localhost:0")
 	if err != nil {
 		panic(err)
 	}
+	if config != nil {
+		l = tls.NewListener(l, config)
+	}
 	s := &Server{
 		Addr: l.Addr().String(),
 		l:    l,
@@ -51,6 +79,45 @@ func NewServer() *Server {
 	return s
 }
 
+func NewCertificate(hosts ...string) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "go.notify"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, pool
+}
+
 func (s *Server) Close() {
 	s.mu.Lock()
 	select {
@@ -66,6 +133,20 @@ func (s *Server) Close() {
 	s.wg.Wait()
 }
 
+func (s *Server) LastRequest() *Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.last
+}
+
+func (s *Server) NumRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.n
+}
+
 func (s *Server) SetPassword(password string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -73,13 +154,29 @@ func (s *Server) SetPassword(password string) {
 	s.password = password
 }
 
+func (s *Server) SetKeepAlive(keepAlive bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keepAlive = keepAlive
+}
+
 func (s *Server) OK(conn net.Conn, i *gntp.Info, action string) {
+	s.OKHeader(conn, i, action, nil)
+}
+
+func (s *Server) OKHeader(conn net.Conn, i *gntp.Info, action string, hdr textproto.MIMEHeader) {
 	i.MessageType = "-OK"
 
 	fmt.Fprintf(conn, "%v\r\n", i)
 	b := new(bytes.Buffer)
 	fmt.Fprintf(b, "Response-Action: %v\r\n", strings.ToUpper(action))
 	b.WriteString("Notification-ID:\r\n")
+	for k, v := range hdr {
+		for _, v := range v {
+			fmt.Fprintf(b, "%v: %v\r\n", k, v)
+		}
+	}
 	if i.EncryptionAlgorithm != gntp.NONE {
 		conn.Write(i.Encrypt(b.Bytes()))
 		io.WriteString(conn, "\r\n\r\n")
@@ -102,33 +199,42 @@ func (s *Server) MockOK(action string, ea gntp.EncryptionAlgorithm) {
 	})
 }
 
+func (s *Server) MockOKHeader(action string, ea gntp.EncryptionAlgorithm, hdr textproto.MIMEHeader) {
+	s.MockEncryptedResponse(ea, func(conn net.Conn, i *gntp.Info) {
+		s.OKHeader(conn, i, action, hdr)
+	})
+}
+
 func (s *Server) MockError(code gntp.ErrorCode) {
 	s.MockResponse(func(conn net.Conn) {
 		s.Error(conn, code)
 	})
 }
 
+func (s *Server) Callback(conn net.Conn, i *gntp.Info, res gntp.Result) {
+	i.MessageType = "-CALLBACK"
+
+	fmt.Fprintf(conn, "%v\r\n", i)
+	b := new(bytes.Buffer)
+	b.WriteString("Application-Name:\r\n")
+	b.WriteString("Notification-ID:\r\n")
+	fmt.Fprintf(b, "Notification-Callback-Result: %v\r\n", res)
+	fmt.Fprintf(b, "Notification-Callback-Timestamp: %v\r\n", time.Now().Format(gntp.RFC3339))
+	b.WriteString("Notification-Callback-Context: context\r\n")
+	b.WriteString("Notification-Callback-Context-Type: context-type\r\n")
+	if i.EncryptionAlgorithm != gntp.NONE {
+		conn.Write(i.Encrypt(b.Bytes()))
+		io.WriteString(conn, "\r\n\r\n")
+	} else {
+		conn.Write(b.Bytes())
+		io.WriteString(conn, "\r\n")
+	}
+}
+
 func (s *Server) MockCallback(res gntp.Result, ea gntp.EncryptionAlgorithm) {
 	s.MockEncryptedResponse(ea, func(conn net.Conn, i *gntp.Info) {
 		s.OK(conn, i, "NOTIFY")
-		// callback
-		i.MessageType = "-CALLBACK"
-
-		fmt.Fprintf(conn, "%v\r\n", i)
-		b := new(bytes.Buffer)
-		b.WriteString("Application-Name:\r\n")
-		b.WriteString("Notification-ID:\r\n")
-		fmt.Fprintf(b, "Notification-Callback-Result: %v\r\n", res)
-		fmt.Fprintf(b, "Notification-Callback-Timestamp: %v\r\n", time.Now().Format(gntp.RFC3339))
-		b.WriteString("Notification-Callback-Context: context\r\n")
-		b.WriteString("Notification-Callback-Context-Type: context-type\r\n")
-		if i.EncryptionAlgorithm != gntp.NONE {
-			conn.Write(i.Encrypt(b.Bytes()))
-			io.WriteString(conn, "\r\n\r\n")
-		} else {
-			conn.Write(b.Bytes())
-			io.WriteString(conn, "\r\n")
-		}
+		s.Callback(conn, i, res)
 	})
 }
 
@@ -186,10 +292,29 @@ func (s *Server) handle(conn net.Conn) {
 	defer conn.Close()
 
 	br := bufio.NewReader(conn)
+	for {
+		h := s.request(conn, br)
+		if h == nil {
+			return
+		}
+		h(conn)
+
+		s.mu.Lock()
+		keepAlive := s.keepAlive
+		s.mu.Unlock()
+		if !keepAlive {
+			return
+		} else if _, err := br.Peek(1); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) request(conn net.Conn, br *bufio.Reader) func(net.Conn) {
 	// GNTP information
 	l, err := br.ReadString('\n')
 	if err != nil && err != io.EOF {
-		return
+		return nil
 	}
 	s.mu.Lock()
 	pwd := s.password
@@ -197,15 +322,15 @@ func (s *Server) handle(conn net.Conn) {
 	i, err := gntp.ParseInfo(l, pwd)
 	if err != nil {
 		s.Error(conn, gntp.UnknownProtocol)
-		return
+		return nil
 	}
 	// auth
 	if pwd != "" && i.KeyHash == nil {
 		s.Error(conn, gntp.NotAuthorized)
-		return
+		return nil
 	}
 	// headers
-	blob := 0
+	var hdrs []textproto.MIMEHeader
 	r := textproto.NewReader(br)
 	if i.EncryptionAlgorithm != gntp.NONE {
 		src, err := util.ReadBytes(br, []byte("\r\n\r\n"))
@@ -216,23 +341,37 @@ func (s *Server) handle(conn net.Conn) {
 		if err != nil {
 			panic(err)
 		}
-		blob = s.numBlob(i, textproto.NewReader(bufio.NewReader(bytes.NewReader(b))))
+		hdrs = s.headers(i, textproto.NewReader(bufio.NewReader(bytes.NewReader(b))))
 	} else {
-		blob = s.numBlob(i, r)
+		hdrs = s.headers(i, r)
 	}
+	blob := s.numBlob(hdrs)
 	// identifiers
-	for i := 0; i < blob; i++ {
+	req := &Request{
+		Info:      i,
+		Header:    hdrs[0],
+		Resources: make(map[string][]byte),
+	}
+	if len(hdrs) > 1 {
+		req.Notifications = hdrs[1:]
+	}
+	for j := 0; j < blob; j++ {
 		hdr, err := r.ReadMIMEHeader()
 		if err != nil {
 			panic(err)
 		}
-		i, err := strconv.Atoi(hdr.Get("Length"))
+		n, err := strconv.Atoi(hdr.Get("Length"))
 		if err != nil {
 			panic(err)
 		}
-		if _, err := br.Discard(i); err != nil {
+		data := make([]byte, n)
+		if _, err := io.ReadFull(br, data); err != nil {
+			panic(err)
+		}
+		if data, err = i.Decrypt(data); err != nil {
 			panic(err)
 		}
+		req.Resources[hdr.Get("Identifier")] = data
 		s.crlf(br)
 		s.crlf(br)
 	}
@@ -240,32 +379,26 @@ func (s *Server) handle(conn net.Conn) {
 
 	// response
 	s.mu.Lock()
-	if len(s.handlers) != 0 {
-		defer s.handlers[0](conn)
-		s.handlers = s.handlers[1:]
-	} else {
-		s.Error(conn, gntp.InternalServerError)
-	}
-	s.mu.Unlock()
-}
+	defer s.mu.Unlock()
 
-func (s *Server) numBlob(i *gntp.Info, r *textproto.Reader) int {
-	blob := make(map[string]struct{})
-	find := func(hdr textproto.MIMEHeader) {
-		for _, v := range hdr {
-			for _, v := range v {
-				if strings.HasPrefix(v, "x-growl-resource://") {
-					blob[v[19:]] = struct{}{}
-				}
-			}
+	s.last = req
+	s.n++
+	if len(s.handlers) == 0 {
+		return func(conn net.Conn) {
+			s.Error(conn, gntp.InternalServerError)
 		}
 	}
+	h := s.handlers[0]
+	s.handlers = s.handlers[1:]
+	return h
+}
 
+func (s *Server) headers(i *gntp.Info, r *textproto.Reader) []textproto.MIMEHeader {
 	hdr, err := r.ReadMIMEHeader()
 	if err != nil && err != io.EOF {
 		panic(err)
 	}
-	find(hdr)
+	hdrs := []textproto.MIMEHeader{hdr}
 	if i.MessageType == "REGISTER" {
 		i, err := strconv.Atoi(hdr.Get("Notifications-Count"))
 		if err != nil {
@@ -276,7 +409,21 @@ func (s *Server) numBlob(i *gntp.Info, r *textproto.Reader) int {
 			if err != nil && err != io.EOF {
 				panic(err)
 			}
-			find(hdr)
+			hdrs = append(hdrs, hdr)
+		}
+	}
+	return hdrs
+}
+
+func (s *Server) numBlob(hdrs []textproto.MIMEHeader) int {
+	blob := make(map[string]struct{})
+	for _, hdr := range hdrs {
+		for _, v := range hdr {
+			for _, v := range v {
+				if id, ok := strings.CutPrefix(v, gntp.ResourceScheme); ok {
+					blob[id] = struct{}{}
+				}
+			}
 		}
 	}
 	return len(blob)
@@ -0,0 +1,182 @@
+//
+// go.notify/gntp :: session.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package gntp
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Session is a connection to the server which is reused across requests
+// where the server keeps it alive after a response. The key is derived once
+// from the Password of the Client when the Session is created, and it is
+// shared by all the requests of the Session.
+//
+// The connection is checked before each request, and a new connection is used
+// if the server has closed it after the last response. The Session connects
+// to the server for each request after that. A request is never resent once
+// it is written, since the server may have processed it.
+//
+// Socket callbacks are not available in a Session since they would be sent
+// on the shared connection.
+type Session struct {
+	c    *Client
+	info *Info
+
+	mu      sync.Mutex
+	conn    net.Conn
+	br      *bufio.Reader
+	lr      *limitedReader
+	percall bool
+}
+
+// NewSession returns a new Session. It does not connect to the server until
+// the first request.
+func (c *Client) NewSession() (*Session, error) {
+	if c.Network == "udp" {
+		return nil, ErrNetwork
+	}
+	i := &Info{
+		Version:             "1.0",
+		HashAlgorithm:       c.HashAlgorithm,
+		EncryptionAlgorithm: c.EncryptionAlgorithm,
+	}
+	if err := i.SetPassword(c.Password); err != nil {
+		return nil, err
+	}
+	return &Session{
+		c:    c,
+		info: i,
+	}, nil
+}
+
+// Register sends a REGISTER request to the server. See Client.Register.
+func (s *Session) Register(n []*Notification) (*Response, error) {
+	b, err := s.c.registerBuffer(n, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.send(context.Background(), "REGISTER", b)
+}
+
+// Notify sends a NOTIFY request to the server with the specified context.
+// See Client.NotifyContext.
+//
+// ErrSession is returned if the Notification requests a socket callback,
+// i.e. it has the CallbackContext without the CallbackTarget.
+func (s *Session) Notify(ctx context.Context, n *Notification) (*Response, error) {
+	if n.CallbackContext != "" && n.CallbackTarget == "" {
+		return nil, ErrSession
+	}
+	b, err := s.c.notifyBuffer(n, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.send(ctx, "NOTIFY", b)
+}
+
+// Close closes the connection of the Session.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.close()
+}
+
+func (s *Session) close() (err error) {
+	if s.conn != nil {
+		err = s.conn.Close()
+		s.conn = nil
+		s.br = nil
+		s.lr = nil
+	}
+	return
+}
+
+func (s *Session) send(ctx context.Context, mt string, b *buffer) (*Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.info.clone()
+	i.MessageType = mt
+	i.cipher = s.info.cipher
+	if i.cipher != nil {
+		// new IV for each request
+		if _, err := rand.Read(i.IV); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.conn != nil && !s.alive() {
+		// the server does not keep the connection alive
+		s.percall = true
+		s.close()
+	}
+	return s.do(ctx, i, b)
+}
+
+// probeTimeout is the time to wait for the close of the connection by
+// the server.
+const probeTimeout = time.Millisecond
+
+// alive reports whether the connection is still open. It is regarded as
+// closed if the server has closed it or sent unexpected data.
+func (s *Session) alive() bool {
+	if s.lr != nil {
+		s.lr.n = s.c.MaxResponseSize
+	}
+	// a past deadline fails without reading
+	s.conn.SetReadDeadline(time.Now().Add(probeTimeout))
+	_, err := s.br.Peek(1)
+	s.conn.SetReadDeadline(time.Time{})
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+func (s *Session) do(ctx context.Context, i *Info, b *buffer) (resp *Response, err error) {
+	if s.conn == nil {
+		if s.conn, err = s.c.dial(ctx); err != nil {
+			s.conn = nil
+			return
+		}
+		var rd io.Reader = s.conn
+		if s.c.MaxResponseSize > 0 {
+			s.lr = &limitedReader{r: s.conn}
+			rd = s.lr
+		}
+		s.br = bufio.NewReader(rd)
+	}
+	conn := s.conn
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+	defer func() {
+		if !stop() {
+			// context is done
+			resp, err = nil, ctx.Err()
+		}
+		if err != nil || s.percall {
+			s.close()
+		}
+	}()
+
+	s.c.record(i)
+	s.c.write(conn, i, b)
+	if s.lr != nil {
+		s.lr.n = s.c.MaxResponseSize
+	}
+	resp, err = s.c.response(s.br)
+	return
+}
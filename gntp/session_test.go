@@ -0,0 +1,170 @@
+//
+// go.notify/gntp :: session_test.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package gntp_test
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"github.com/hattya/go.notify/gntp"
+)
+
+func TestSession(t *testing.T) {
+	for _, keepAlive := range []bool{true, false} {
+		var dials atomic.Int32
+		s := NewServer()
+		defer s.Close()
+		s.SetPassword(password)
+		s.SetKeepAlive(keepAlive)
+
+		c := gntp.New()
+		c.Server = s.Addr
+		c.Name = name
+		c.Password = password
+		c.HashAlgorithm = gntp.SHA256
+		c.EncryptionAlgorithm = gntp.AES
+		c.Dialer = &net.Dialer{
+			Control: func(network, address string, c syscall.RawConn) error {
+				dials.Add(1)
+				return nil
+			},
+		}
+
+		closed := make(chan struct{}, 1)
+		mockOK := func(action string) {
+			s.MockEncryptedResponse(gntp.AES, func(conn net.Conn, i *gntp.Info) {
+				s.OK(conn, i, action)
+				if !keepAlive {
+					conn.Close()
+					closed <- struct{}{}
+				}
+			})
+		}
+		wait := func() {
+			if !keepAlive {
+				<-closed
+			}
+		}
+
+		sess, err := c.NewSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mockOK("REGISTER")
+		if _, err := sess.Register([]*gntp.Notification{{Name: "Name"}}); err != nil {
+			t.Fatal(err)
+		}
+		wait()
+		var iv []byte
+		for i := 0; i < 3; i++ {
+			mockOK("NOTIFY")
+			n := &gntp.Notification{
+				Name:  "Name",
+				Title: "Title",
+			}
+			if _, err := sess.Notify(context.Background(), n); err != nil {
+				t.Fatal(err)
+			}
+			req := s.LastRequest()
+			if g, e := req.Header.Get("Notification-Title"), "Title"; g != e {
+				t.Errorf("expected %q, got %q", e, g)
+			}
+			if string(req.Info.IV) == string(iv) {
+				t.Error("expected new IV")
+			}
+			iv = req.Info.IV
+			wait()
+		}
+		var e int32 = 1
+		if !keepAlive {
+			e = 4
+		}
+		if g := dials.Load(); g != e {
+			t.Errorf("keep-alive = %v: expected %v dials, got %v", keepAlive, e, g)
+		}
+		if g, e := s.NumRequests(), 4; g != e {
+			t.Errorf("keep-alive = %v: expected %v requests, got %v", keepAlive, e, g)
+		}
+		if err := sess.Close(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSessionDrop(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.SetKeepAlive(true)
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+
+	sess, err := c.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.Close()
+
+	s.MockOK("REGISTER", gntp.NONE)
+	if _, err := sess.Register([]*gntp.Notification{{Name: "Name"}}); err != nil {
+		t.Fatal(err)
+	}
+	// the server processes the request, and closes the connection without
+	// a response
+	s.MockResponse(func(conn net.Conn) {
+		conn.Close()
+	})
+	if _, err := sess.Notify(context.Background(), &gntp.Notification{Name: "Name"}); err == nil {
+		t.Error("expected error")
+	}
+	if g, e := s.NumRequests(), 2; g != e {
+		t.Errorf("expected %v requests, got %v", e, g)
+	}
+	// new connection
+	s.MockOK("NOTIFY", gntp.NONE)
+	if _, err := sess.Notify(context.Background(), &gntp.Notification{Name: "Name"}); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := s.NumRequests(), 3; g != e {
+		t.Errorf("expected %v requests, got %v", e, g)
+	}
+}
+
+func TestSessionError(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+
+	sess, err := c.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.Close()
+
+	n := &gntp.Notification{
+		Name:                "Name",
+		CallbackContext:     "Context",
+		CallbackContextType: "Type",
+	}
+	if _, err := sess.Notify(context.Background(), n); err != gntp.ErrSession {
+		t.Errorf("expected ErrSession, got %#v", err)
+	}
+	// udp
+	c.Network = "udp"
+	if _, err := c.NewSession(); err != gntp.ErrNetwork {
+		t.Errorf("expected ErrNetwork, got %#v", err)
+	}
+}
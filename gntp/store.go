@@ -0,0 +1,140 @@
+//
+// go.notify/gntp :: store.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package gntp
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResourceStore is the interface that hosts binary resources by reference.
+type ResourceStore interface {
+	// Store stores the data identified by the id, and returns the URL to
+	// refer to it. The id is the hex-encoded hash of the data.
+	Store(id string, data []byte) (string, error)
+}
+
+// HTTPStore is a ResourceStore which serves the resources at a local HTTP
+// endpoint.
+//
+// The resources are served as plain HTTP without authentication, so they are
+// not protected by the EncryptionAlgorithm of the Client.
+type HTTPStore struct {
+	// URL is the base URL of the resources. It can be modified to the
+	// address which the server can reach.
+	URL string
+
+	// TTL specifies how long the resource is served after it is stored
+	// last time. The resource is served until it is removed if TTL is 0.
+	TTL time.Duration
+
+	srv *http.Server
+	l   net.Listener
+
+	mu  sync.Mutex
+	res map[string]*entry
+}
+
+type entry struct {
+	data    []byte
+	expires time.Time
+}
+
+// NewHTTPStore returns a new HTTPStore which listens on the TCP network
+// address addr.
+//
+// The host name of the local machine is used for the URL if the host of addr
+// is empty or an unspecified address such as "0.0.0.0", since the server
+// cannot fetch the resources from it.
+func NewHTTPStore(addr string) (*HTTPStore, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	host, port, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		if host, err = hostname(); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	s := &HTTPStore{
+		URL: "http://" + net.JoinHostPort(host, port) + "/",
+		l:   l,
+		res: make(map[string]*entry),
+	}
+	s.srv = &http.Server{Handler: s}
+	go s.srv.Serve(l)
+	return s, nil
+}
+
+// Close stops serving the resources, and removes all of them.
+func (s *HTTPStore) Close() error {
+	s.mu.Lock()
+	clear(s.res)
+	s.mu.Unlock()
+	return s.srv.Shutdown(context.Background())
+}
+
+// Store implements the ResourceStore interface.
+func (s *HTTPStore) Store(id string, data []byte) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+	e, ok := s.res[id]
+	if !ok {
+		e = &entry{data: data}
+		s.res[id] = e
+	}
+	if s.TTL > 0 {
+		e.expires = time.Now().Add(s.TTL)
+	}
+	return s.URL + id, nil
+}
+
+// Remove removes the resource identified by the id.
+func (s *HTTPStore) Remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.res, id)
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *HTTPStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/")
+	s.mu.Lock()
+	s.expire()
+	e, ok := s.res[id]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(e.data))
+}
+
+func (s *HTTPStore) expire() {
+	now := time.Now()
+	for id, e := range s.res {
+		if !e.expires.IsZero() && now.After(e.expires) {
+			delete(s.res, id)
+		}
+	}
+}
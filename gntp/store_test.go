@@ -0,0 +1,113 @@
+//
+// go.notify/gntp :: store_test.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package gntp_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hattya/go.notify/gntp"
+)
+
+func TestHTTPStore(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	store, err := gntp.NewHTTPStore("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	c := gntp.New()
+	c.Server = s.Addr
+	c.Name = name
+	c.Icon = []byte("icon")
+	c.ResourceStore = store
+
+	s.MockOK("REGISTER", gntp.NONE)
+	if _, err := c.Register(nil); err != nil {
+		t.Fatal(err)
+	}
+	req := s.LastRequest()
+	if g, e := len(req.Resources), 0; g != e {
+		t.Errorf("expected %v resources, got %v", e, g)
+	}
+	u := req.Header.Get("Application-Icon")
+	if !strings.HasPrefix(u, store.URL) {
+		t.Fatalf("unexpected icon: %q", u)
+	}
+	if g, e := get(t, u), c.Icon.([]byte); !bytes.Equal(g, e) {
+		t.Errorf("expected %q, got %q", e, g)
+	}
+	// not found
+	if g := get(t, store.URL+"unknown"); g != nil {
+		t.Errorf("expected not found, got %q", g)
+	}
+	// remove
+	store.Remove(u[len(store.URL):])
+	if g := get(t, u); g != nil {
+		t.Errorf("expected not found, got %q", g)
+	}
+	// expire
+	store.TTL = time.Millisecond
+	if _, err := store.Store("id", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if g := get(t, store.URL+"id"); g != nil {
+		t.Errorf("expected not found, got %q", g)
+	}
+}
+
+func TestHTTPStoreURL(t *testing.T) {
+	name, err := os.Hostname()
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, addr := range []string{":0", "0.0.0.0:0"} {
+		store, err := gntp.NewHTTPStore(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := url.Parse(store.URL)
+		store.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, e := u.Hostname(), name; g != e {
+			t.Errorf("%v: expected %q, got %q", addr, e, g)
+		}
+	}
+}
+
+func get(t *testing.T, u string) []byte {
+	t.Helper()
+
+	resp, err := http.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
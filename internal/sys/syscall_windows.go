@@ -1,7 +1,7 @@
 //
 // go.notify/internal/sys :: syscall_windows.go
 //
-//   Copyright (c) 2017-2023 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2017-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -75,6 +75,10 @@ func IsWindowsVersionOrGreater(major, minor uint32, sp uint16) bool {
 	return VerifyVersionInfo(&vi, VER_MAJORVERSION|VER_MINORVERSION|VER_SERVICEPACKMAJOR, VerSetConditionMask(VerSetConditionMask(VerSetConditionMask(0, VER_MAJORVERSION, VER_GREATER_EQUAL), VER_MINORVERSION, VER_GREATER_EQUAL), VER_SERVICEPACKMAJOR, VER_GREATER_EQUAL))
 }
 
+func HiWord(v uint32) uint16 {
+	return uint16(v >> 16 & 0xffff)
+}
+
 func LoWord(v uint32) uint16 {
 	return uint16(v & 0xffff)
 }
@@ -110,6 +114,8 @@ func VerSetConditionMask(lConditionMask uint64, typeBitMask uint32, conditionMas
 
 const GWL_USERDATA = -21
 
+const SERVICE_USER_SERVICE = 0x00000040
+
 const (
 	IMAGE_BITMAP = iota
 	IMAGE_ICON
@@ -127,18 +133,30 @@ const (
 	MF_SEPARATOR = 0x00000800
 )
 
+const (
+	MOD_ALT      = 0x0001
+	MOD_CONTROL  = 0x0002
+	MOD_SHIFT    = 0x0004
+	MOD_WIN      = 0x0008
+	MOD_NOREPEAT = 0x4000
+)
+
 const TPM_RIGHTALIGN = 0x0008
 
 const (
-	WM_CLOSE       = 0x0010
-	WM_COMMAND     = 0x0111
-	WM_CONTEXTMENU = 0x007b
-	WM_CREATE      = 0x0001
-	WM_DESTROY     = 0x0002
-	WM_NULL        = 0x0000
-	WM_RBUTTONUP   = 0x0205
-	WM_SYSKEYDOWN  = 0x0104
-	WM_USER        = 0x0400
+	WM_CLOSE         = 0x0010
+	WM_COMMAND       = 0x0111
+	WM_CONTEXTMENU   = 0x007b
+	WM_CREATE        = 0x0001
+	WM_DESTROY       = 0x0002
+	WM_HOTKEY        = 0x0312
+	WM_LBUTTONDBLCLK = 0x0203
+	WM_LBUTTONUP     = 0x0202
+	WM_NULL          = 0x0000
+	WM_RBUTTONUP     = 0x0205
+	WM_SETTINGCHANGE = 0x001a
+	WM_SYSKEYDOWN    = 0x0104
+	WM_USER          = 0x0400
 )
 
 const WS_POPUP = 0x80000000
@@ -217,23 +235,50 @@ func MakeIntResource(i uint16) *uint16 {
 //sys	PostMessage(wnd windows.Handle, msg uint32, wParam uintptr, lParam uintptr) (err error) = user32.PostMessageW
 //sys	PostQuitMessage(exitCode int32) = user32.PostQuitMessage
 //sys	RegisterClassEx(wcx *WndClassEx) (atom uint16, err error) = user32.RegisterClassExW
+//sys	RegisterHotKey(wnd windows.Handle, id int32, modifiers uint32, vk uint32) (err error) = user32.RegisterHotKey
 //sys	RegisterWindowMessage(s *uint16) (msg uint32, err error) = user32.RegisterWindowMessageW
 //sys	ReleaseDC(wnd windows.Handle, dc windows.Handle) (err error) = user32.ReleaseDC
+//sys	SendMessage(wnd windows.Handle, msg uint32, wParam uintptr, lParam uintptr) (res uintptr) = user32.SendMessageW
 //sys	SetForegroundWindow(wnd windows.Handle) (err error) = user32.SetForegroundWindow
 //sys	setWindowLong(wnd windows.Handle, i int32, ptr unsafe.Pointer) (oldptr uintptr, err error) = user32.SetWindowLongW
 //sys	setWindowLongPtr(wnd windows.Handle, i int32, ptr unsafe.Pointer) (oldptr uintptr, err error) = user32.SetWindowLongPtrW
 //sys	TrackPopupMenu(menu windows.Handle, flags uint32, x int32, y int32, reserved int32, wnd windows.Handle) (ret int32, err error) = user32.TrackPopupMenu
 //sys	TranslateMessage(msg *Msg) (err error) = user32.TranslateMessage
+//sys	UnregisterHotKey(wnd windows.Handle, id int32) (err error) = user32.UnregisterHotKey
 
 func RGB(r, g, b uint8) uint32 {
 	return uint32(r) | uint32(g)<<8 | uint32(b)<<16
 }
 
+type BitmapInfoHeader struct {
+	Size          uint32
+	Width         int32
+	Height        int32
+	Planes        uint16
+	BitCount      uint16
+	Compression   uint32
+	SizeImage     uint32
+	XPelsPerMeter int32
+	YPelsPerMeter int32
+	ClrUsed       uint32
+	ClrImportant  uint32
+}
+
+type BitmapInfo struct {
+	Header BitmapInfoHeader
+	Colors [1]uint32
+}
+
+const BI_RGB = 0
+
+const DIB_RGB_COLORS = 0
+
 //sys	CreateCompatibleBitmap(dc windows.Handle, w int32, h int32) (bm windows.Handle, err error) = gdi32.CreateCompatibleBitmap
 //sys	CreateCompatibleDC(dc windows.Handle) (mdc windows.Handle, err error) = gdi32.CreateCompatibleDC
 //sys	DeleteDC(dc windows.Handle) (err error) = gdi32.DeleteDC
 //sys	DeleteObject(obj windows.Handle) (err error) = gdi32.DeleteObject
 //sys	SelectObject(dc windows.Handle, obj windows.Handle) (oldobj windows.Handle, err error) = gdi32.SelectObject
+//sys	SetDIBits(dc windows.Handle, bm windows.Handle, start uint32, lines uint32, bits unsafe.Pointer, bmi *BitmapInfo, usage uint32) (ret int32, err error) [failretval==0] = gdi32.SetDIBits
 //sys	SetPixel(dc windows.Handle, x int32, y int32, color uint32) (err error) [failretval==^uintptr(0)] = gdi32.SetPixel
 
 type DLLVersionInfo struct {
@@ -307,6 +352,11 @@ const (
 	NIF_SHOWTIP
 )
 
+const (
+	NIN_SELECT    = WM_USER
+	NIN_KEYSELECT = NIN_SELECT | 0x1
+)
+
 const (
 	NIN_BALLOONSHOW = WM_USER + 2 + iota
 	NIN_BALLOONHIDE
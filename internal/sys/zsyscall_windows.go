@@ -48,6 +48,7 @@ var (
 	procDeleteDC               = modgdi32.NewProc("DeleteDC")
 	procDeleteObject           = modgdi32.NewProc("DeleteObject")
 	procSelectObject           = modgdi32.NewProc("SelectObject")
+	procSetDIBits              = modgdi32.NewProc("SetDIBits")
 	procSetPixel               = modgdi32.NewProc("SetPixel")
 	procGetModuleHandleW       = modkernel32.NewProc("GetModuleHandleW")
 	procShell_NotifyIconW      = modshell32.NewProc("Shell_NotifyIconW")
@@ -69,13 +70,16 @@ var (
 	procPostMessageW           = moduser32.NewProc("PostMessageW")
 	procPostQuitMessage        = moduser32.NewProc("PostQuitMessage")
 	procRegisterClassExW       = moduser32.NewProc("RegisterClassExW")
+	procRegisterHotKey         = moduser32.NewProc("RegisterHotKey")
 	procRegisterWindowMessageW = moduser32.NewProc("RegisterWindowMessageW")
 	procReleaseDC              = moduser32.NewProc("ReleaseDC")
+	procSendMessageW           = moduser32.NewProc("SendMessageW")
 	procSetForegroundWindow    = moduser32.NewProc("SetForegroundWindow")
 	procSetWindowLongPtrW      = moduser32.NewProc("SetWindowLongPtrW")
 	procSetWindowLongW         = moduser32.NewProc("SetWindowLongW")
 	procTrackPopupMenu         = moduser32.NewProc("TrackPopupMenu")
 	procTranslateMessage       = moduser32.NewProc("TranslateMessage")
+	procUnregisterHotKey       = moduser32.NewProc("UnregisterHotKey")
 )
 
 func CreateCompatibleBitmap(dc windows.Handle, w int32, h int32) (bm windows.Handle, err error) {
@@ -121,6 +125,15 @@ func SelectObject(dc windows.Handle, obj windows.Handle) (oldobj windows.Handle,
 	return
 }
 
+func SetDIBits(dc windows.Handle, bm windows.Handle, start uint32, lines uint32, bits unsafe.Pointer, bmi *BitmapInfo, usage uint32) (ret int32, err error) {
+	r0, _, e1 := syscall.Syscall9(procSetDIBits.Addr(), 7, uintptr(dc), uintptr(bm), uintptr(start), uintptr(lines), uintptr(bits), uintptr(unsafe.Pointer(bmi)), uintptr(usage), 0, 0)
+	ret = int32(r0)
+	if ret == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
 func SetPixel(dc windows.Handle, x int32, y int32, color uint32) (err error) {
 	r1, _, e1 := syscall.Syscall6(procSetPixel.Addr(), 4, uintptr(dc), uintptr(x), uintptr(y), uintptr(color), 0, 0)
 	if r1 == ^uintptr(0) {
@@ -292,6 +305,14 @@ func RegisterClassEx(wcx *WndClassEx) (atom uint16, err error) {
 	return
 }
 
+func RegisterHotKey(wnd windows.Handle, id int32, modifiers uint32, vk uint32) (err error) {
+	r1, _, e1 := syscall.Syscall6(procRegisterHotKey.Addr(), 4, uintptr(wnd), uintptr(id), uintptr(modifiers), uintptr(vk), 0, 0)
+	if r1 == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
 func RegisterWindowMessage(s *uint16) (msg uint32, err error) {
 	r0, _, e1 := syscall.Syscall(procRegisterWindowMessageW.Addr(), 1, uintptr(unsafe.Pointer(s)), 0, 0)
 	msg = uint32(r0)
@@ -309,6 +330,12 @@ func ReleaseDC(wnd windows.Handle, dc windows.Handle) (err error) {
 	return
 }
 
+func SendMessage(wnd windows.Handle, msg uint32, wParam uintptr, lParam uintptr) (res uintptr) {
+	r0, _, _ := syscall.Syscall6(procSendMessageW.Addr(), 4, uintptr(wnd), uintptr(msg), uintptr(wParam), uintptr(lParam), 0, 0)
+	res = uintptr(r0)
+	return
+}
+
 func SetForegroundWindow(wnd windows.Handle) (err error) {
 	r1, _, e1 := syscall.Syscall(procSetForegroundWindow.Addr(), 1, uintptr(wnd), 0, 0)
 	if r1 == 0 {
@@ -351,3 +378,11 @@ func TranslateMessage(msg *Msg) (err error) {
 	}
 	return
 }
+
+func UnregisterHotKey(wnd windows.Handle, id int32) (err error) {
+	r1, _, e1 := syscall.Syscall(procUnregisterHotKey.Addr(), 2, uintptr(wnd), uintptr(id), 0)
+	if r1 == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
@@ -1,7 +1,7 @@
 //
 // go.notify/windows :: export_windows_test.go
 //
-//   Copyright (c) 2017-2021 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2017-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -16,8 +16,32 @@ import (
 var (
 	shellDLLVersion [][]uint32
 	windowsVersion  []uint32
+	lightTheme      []bool
+	iconSize        int32
+	setVersion      uint32
+	executed        = make(chan string, 1)
 )
 
+func IsServiceRunningIn(services []windows.ENUM_SERVICE_STATUS_PROCESS) bool {
+	return isServiceRunning(services)
+}
+
+func Executed() <-chan string {
+	return executed
+}
+
+func IconSize() int {
+	return int(iconSize)
+}
+
+func SetVersion() uint32 {
+	return setVersion
+}
+
+func MockLightTheme(light bool) {
+	lightTheme = append(lightTheme, light)
+}
+
 func MockShellDLLVersion(major, minor, build uint32) {
 	shellDLLVersion = append(shellDLLVersion, []uint32{major, minor, build})
 }
@@ -36,6 +60,11 @@ func MockWindows2000() {
 
 var WM_TASKBARCREATED uint32
 
+const (
+	WM_SHOWTIMEOUT = wmShowTimeout
+	WM_MODIFY      = wmModify
+)
+
 func init() {
 	WM_TASKBARCREATED = _WM_TASKBARCREATED
 
@@ -63,9 +92,28 @@ func init() {
 		windowsVersion = windowsVersion[1:]
 		return v >= 0x05010200
 	}
-	loadImage = func(windows.Handle, *uint16, uint32, int32, int32, uint32) (windows.Handle, error) {
+	usesLightTheme = func() bool {
+		if len(lightTheme) == 0 {
+			return systemUsesLightTheme()
+		}
+		v := lightTheme[0]
+		lightTheme = lightTheme[1:]
+		return v
+	}
+	loadImage = func(_ windows.Handle, _ *uint16, _ uint32, cx, _ int32, _ uint32) (windows.Handle, error) {
+		iconSize = cx
 		return sys.LoadImage(0, sys.MakeIntResource(32512), sys.IMAGE_ICON, 0, 0, sys.LR_DEFAULTSIZE|sys.LR_SHARED)
 	}
+	shellExecute = func(_ windows.Handle, _, file, _, _ *uint16, _ int32) error {
+		executed <- windows.UTF16PtrToString(file)
+		return nil
+	}
+	shellNotifyIcon = func(msg uint32, data *sys.NotifyIconData) error {
+		if msg == sys.NIM_SETVERSION {
+			setVersion = data.Version
+		}
+		return sys.Shell_NotifyIcon(msg, data)
+	}
 	testHookPrepare = func(ni *NotifyIcon) {
 		if ni.data.Flags&sys.NIF_GUID != 0 {
 			// test binary is in a temporary folder
@@ -93,11 +141,49 @@ func (ni *NotifyIcon) Data() sys.NotifyIconData {
 	return ni.data
 }
 
+func (ni *NotifyIcon) Info(n *Notification) (sys.NotifyIconData, error) {
+	return ni.info(n)
+}
+
 func (ni *NotifyIcon) Prepare(data sys.NotifyIconData) error {
 	ni.data = data
 	return ni.prepare()
 }
 
+func (i *Icon) Handle() windows.Handle {
+	return i.h
+}
+
+func (ni *NotifyIcon) AwaitShow() {
+	ni.begin("")
+}
+
+func (ni *NotifyIcon) Lock() {
+	ni.mu.Lock()
+}
+
+func (ni *NotifyIcon) Unlock() {
+	ni.mu.Unlock()
+}
+
+func (ni *NotifyIcon) Token() uintptr {
+	ni.tmu.Lock()
+	defer ni.tmu.Unlock()
+
+	return ni.cur
+}
+
+func (ni *NotifyIcon) Queue() []string {
+	ni.qmu.Lock()
+	defer ni.qmu.Unlock()
+
+	var titles []string
+	for _, b := range ni.queue {
+		titles = append(titles, windows.UTF16ToString(b.data.InfoTitle[:]))
+	}
+	return titles
+}
+
 func (ni *NotifyIcon) PostMessage(msg uint32, wParam, lParam uintptr) error {
 	return sys.PostMessage(ni.wnd, msg, wParam, lParam)
 }
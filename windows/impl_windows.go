@@ -1,7 +1,7 @@
 //
 // go.notify/windows :: impl_windows.go
 //
-//   Copyright (c) 2017-2019 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2017-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -17,8 +17,10 @@ import (
 )
 
 type notifier struct {
-	ni *NotifyIcon
-	ev map[string]*Notification
+	ni   *NotifyIcon
+	icon *Icon
+	ev   map[string]*Notification
+	tray map[string]*Icon
 }
 
 // NewNotifier returns a new Notifier.
@@ -30,10 +32,22 @@ type notifier struct {
 //   - *Icon
 //
 // Register accepts following keys and value types:
+//   - windows:balloon-icon  image.Image, *Icon, or IconType
+//     This is used for the notification balloon instead of the specified
+//     icon, and then the specified icon is used for the notification area
+//     while the event is notified.
 //   - windows:fallback-icon IconType
 //     This is used on Windows XP or earlier if the specified icon is *Icon.
+//   - windows:icon-size     int
+//     The icon resources are loaded at the specified size in pixels instead
+//     of the default size. It must be in the range of 1 to 256.
 //   - windows:sound         bool
 //     This is ignored on Windows 2000 or earlier.
+//
+// The returned Notifier also has the following method to remove the
+// registered event:
+//
+//	Unregister(event string) error
 func NewNotifier(name string, icon *Icon) (notify.Notifier, error) {
 	ni, err := New(name)
 	if err != nil {
@@ -41,8 +55,10 @@ func NewNotifier(name string, icon *Icon) (notify.Notifier, error) {
 	}
 	ni.Icon = icon
 	return &notifier{
-		ni: ni,
-		ev: make(map[string]*Notification),
+		ni:   ni,
+		icon: icon,
+		ev:   make(map[string]*Notification),
+		tray: make(map[string]*Icon),
 	}, nil
 }
 
@@ -51,46 +67,41 @@ func (p *notifier) Close() error {
 }
 
 func (p *notifier) Register(event string, icon notify.Icon, opts map[string]interface{}) error {
-	loadIconI := func(i int64) (notify.Icon, error) {
-		if 0 <= i && i <= math.MaxUint16 {
-			return LoadIcon(uint16(i))
-		}
-		return i, nil
-	}
-	loadIconU := func(u uint64) (notify.Icon, error) {
-		if u <= math.MaxUint16 {
-			return LoadIcon(uint16(u))
+	var size int
+	k := "windows:icon-size"
+	if v, ok := opts[k]; ok {
+		if i, ok := v.(int); ok {
+			if i < 1 || 256 < i {
+				return ErrIconSize
+			}
+			size = i
+		} else {
+			return fmt.Errorf("%q expects int: %T", k, v)
 		}
-		return u, nil
-	}
-	var err error
-	switch v := icon.(type) {
-	case image.Image:
-		icon, err = LoadImage(v)
-	case int:
-		icon, err = loadIconI(int64(v))
-	case int8:
-		icon, err = loadIconI(int64(v))
-	case int16:
-		icon, err = loadIconI(int64(v))
-	case int32:
-		icon, err = loadIconI(int64(v))
-	case int64:
-		icon, err = loadIconI(v)
-	case uint:
-		icon, err = loadIconU(uint64(v))
-	case uint8:
-		icon, err = loadIconU(uint64(v))
-	case uint16:
-		icon, err = loadIconU(uint64(v))
-	case uint32:
-		icon, err = loadIconU(uint64(v))
-	case uint64:
-		icon, err = loadIconU(v)
 	}
+	icon, err := loadIcon(icon, size)
 	if err != nil {
 		return err
 	}
+	var tray *Icon
+	k = "windows:balloon-icon"
+	if v, ok := opts[k]; ok {
+		switch v.(type) {
+		case image.Image, *Icon, IconType:
+		default:
+			return fmt.Errorf("%q expects image.Image, *Icon, or IconType: %T", k, v)
+		}
+		switch i := icon.(type) {
+		case nil:
+		case *Icon:
+			tray = i
+		default:
+			return fmt.Errorf("unsupported tray icon: %T", icon)
+		}
+		if icon, err = loadIcon(v, size); err != nil {
+			return err
+		}
+	}
 
 	n := &Notification{Sound: true}
 	switch icon := icon.(type) {
@@ -114,7 +125,7 @@ func (p *notifier) Register(event string, icon notify.Icon, opts map[string]inte
 	default:
 		return fmt.Errorf("unsupported icon: %T", icon)
 	}
-	k := "windows:sound"
+	k = "windows:sound"
 	if v, ok := opts[k]; ok {
 		if b, ok := v.(bool); ok {
 			if isShellDLLVersionOrGreater(6, 0, 0) {
@@ -127,6 +138,62 @@ func (p *notifier) Register(event string, icon notify.Icon, opts map[string]inte
 		}
 	}
 	p.ev[event] = n
+	p.tray[event] = tray
+	return nil
+}
+
+func loadIcon(icon notify.Icon, size int) (notify.Icon, error) {
+	load := func(i uint16) (notify.Icon, error) {
+		if size > 0 {
+			return LoadIconSize(i, size)
+		}
+		return LoadIcon(i)
+	}
+	loadIconI := func(i int64) (notify.Icon, error) {
+		if 0 <= i && i <= math.MaxUint16 {
+			return load(uint16(i))
+		}
+		return i, nil
+	}
+	loadIconU := func(u uint64) (notify.Icon, error) {
+		if u <= math.MaxUint16 {
+			return load(uint16(u))
+		}
+		return u, nil
+	}
+	switch v := icon.(type) {
+	case image.Image:
+		return LoadImage(v)
+	case int:
+		return loadIconI(int64(v))
+	case int8:
+		return loadIconI(int64(v))
+	case int16:
+		return loadIconI(int64(v))
+	case int32:
+		return loadIconI(int64(v))
+	case int64:
+		return loadIconI(v)
+	case uint:
+		return loadIconU(uint64(v))
+	case uint8:
+		return loadIconU(uint64(v))
+	case uint16:
+		return loadIconU(uint64(v))
+	case uint32:
+		return loadIconU(uint64(v))
+	case uint64:
+		return loadIconU(v)
+	}
+	return icon, nil
+}
+
+func (p *notifier) Unregister(event string) error {
+	if _, ok := p.ev[event]; !ok {
+		return notify.ErrEvent
+	}
+	delete(p.ev, event)
+	delete(p.tray, event)
 	return nil
 }
 
@@ -139,6 +206,11 @@ func (p *notifier) Notify(event, title, body string) error {
 	}
 	n.Title = title
 	n.Body = body
+	if tray := p.tray[event]; tray != nil {
+		p.ni.Icon = tray
+	} else {
+		p.ni.Icon = p.icon
+	}
 	return p.ni.Notify(n)
 }
 
@@ -1,7 +1,7 @@
 //
 // go.notify/windows :: impl_windows_test.go
 //
-//   Copyright (c) 2017-2020 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2017-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -89,6 +89,58 @@ func TestNotifierRegister(t *testing.T) {
 		t.Error("expected error")
 	}
 
+	// windows:balloon-icon
+	for _, v := range []interface{}{
+		image.NewGray(image.Rect(0, 0, 32, 32)),
+		icon,
+		windows.IconWarn,
+	} {
+		opts = map[string]interface{}{
+			"windows:balloon-icon": v,
+		}
+		if err := n.Register("event", icon, opts); err != nil {
+			t.Error(err)
+		}
+	}
+	// error
+	for _, tt := range []struct {
+		icon notify.Icon
+		v    interface{}
+	}{
+		{icon, 1},
+		{icon, image.NewAlpha(image.Rect(0, 0, 32, 32))},
+		{windows.IconInfo, windows.IconWarn},
+	} {
+		opts = map[string]interface{}{
+			"windows:balloon-icon": tt.v,
+		}
+		if err := n.Register("event", tt.icon, opts); err == nil {
+			t.Error("expected error")
+		}
+	}
+
+	// windows:icon-size
+	for _, size := range []int{16, 32} {
+		opts = map[string]interface{}{
+			"windows:icon-size": size,
+		}
+		if err := n.Register("event", uint16(1), opts); err != nil {
+			t.Error(err)
+		}
+		if g, e := windows.IconSize(), size; g != e {
+			t.Errorf("expected %v, got %v", e, g)
+		}
+	}
+	// error
+	for _, v := range []interface{}{0, 257, "16"} {
+		opts = map[string]interface{}{
+			"windows:icon-size": v,
+		}
+		if err := n.Register("event", uint16(1), opts); err == nil {
+			t.Error("expected error")
+		}
+	}
+
 	// windows:sound
 	opts = map[string]interface{}{
 		"windows:sound": false,
@@ -112,6 +164,74 @@ func TestNotifierRegister(t *testing.T) {
 	}
 }
 
+func TestNotifierBalloonIcon(t *testing.T) {
+	icon, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer icon.Close()
+
+	n, err := windows.NewNotifier(name, icon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	tray, err := windows.LoadImage(image.NewGray(image.Rect(0, 0, 16, 16)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := map[string]interface{}{
+		"windows:balloon-icon": image.NewGray(image.Rect(0, 0, 32, 32)),
+		"windows:sound":        false,
+	}
+	if err := n.Register("event", tray, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify("event", "Title", "Body"); err != nil {
+		t.Fatal(err)
+	}
+	ni := n.Sys().(*windows.NotifyIcon)
+	if ni.Icon != tray {
+		t.Error("expected the tray icon")
+	}
+	// restored
+	if err := n.Register("plain", windows.IconInfo, map[string]interface{}{"windows:sound": false}); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify("plain", "Title", "Body"); err != nil {
+		t.Fatal(err)
+	}
+	if ni.Icon != icon {
+		t.Error("expected the default icon")
+	}
+}
+
+func TestNotifierUnregister(t *testing.T) {
+	n, err := windows.NewNotifier(name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	u := n.(interface {
+		Unregister(string) error
+	})
+	if err := n.Register("event", windows.IconInfo, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Unregister("event"); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify("event", "Title", "Body"); err != notify.ErrEvent {
+		t.Errorf("expected ErrEvent, got %v", err)
+	}
+	// unknown event
+	if err := u.Unregister("event"); err != notify.ErrEvent {
+		t.Errorf("expected ErrEvent, got %v", err)
+	}
+}
+
 func TestNotifierNotify(t *testing.T) {
 	n, err := windows.NewNotifier(name, nil)
 	if err != nil {
@@ -1,12 +1,12 @@
 //
 // go.notify/windows :: notify_windows.go
 //
-//   Copyright (c) 2017-2024 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2017-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
 
-//go:generate stringer -type BalloonEvent,IconType -output notify_string_windows.go
+//go:generate stringer -type ActivateKind,BalloonEvent,IconType -output notify_string_windows.go
 
 // Package windows implements the Windows Notifications.
 //
@@ -19,24 +19,42 @@ import (
 	"errors"
 	"fmt"
 	"image"
+	"math"
+	"net/url"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"github.com/hattya/go.notify/internal/sys"
 	"github.com/hattya/go.notify/internal/util"
 	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
 )
 
 var (
-	ErrGUID = errors.New("notify: invalid GUID format")
-	ErrIcon = errors.New("notify: unknown icon type")
+	ErrGUID     = errors.New("notify: invalid GUID format")
+	ErrHotKeyID = errors.New("notify: hotkey id overflows 0xbfff")
+	ErrIcon     = errors.New("notify: unknown icon type")
+	ErrIconSize = errors.New("notify: invalid icon size")
+	ErrMenuID   = errors.New("notify: menu item id overflows uint16 range")
+	ErrQueue    = errors.New("notify: notification queue is full")
+	ErrURL      = errors.New("notify: URL must be an http or https URL")
 )
 
 const className = "go.notify.Window"
 
+// private messages of the window
+const (
+	wmRegisterHotKey = sys.WM_USER + 1 + iota
+	wmUnregisterHotKey
+	wmShowTimeout
+	wmModify
+)
+
 var _WM_TASKBARCREATED uint32
 
 func init() {
@@ -64,22 +82,63 @@ var (
 	isWindows7OrGreater        = sys.IsWindows7OrGreater
 	isWindowsXPSP2OrGreater    = sys.IsWindowsXPSP2OrGreater
 	loadImage                  = sys.LoadImage
+	shellExecute               = windows.ShellExecute
+	shellNotifyIcon            = sys.Shell_NotifyIcon
+	usesLightTheme             = systemUsesLightTheme
 	testHookPrepare            func(*NotifyIcon)
 	testHookNotify             func(*Notification)
 )
 
 // NotifyIcon represents a notification icon in the notification area.
+//
+// The LightIcon and the DarkIcon are used instead of the Icon according to
+// the theme of the taskbar if they are not nil, and they are switched when
+// the theme is changed. The taskbar is regarded as dark on Windows before
+// Windows 10 May 2019 Update.
 type NotifyIcon struct {
-	Icon    *Icon
-	GUID    GUID              // requires Windows 7 or later
-	Balloon chan BalloonEvent // requires Windows XP or later
-	Menu    chan MenuEvent
+	Icon      *Icon
+	LightIcon *Icon              // used for the light taskbar
+	DarkIcon  *Icon              // used for the dark taskbar
+	GUID      GUID               // requires Windows 7 or later
+	Activate  chan ActivateEvent // requires Windows 2000 or later for KeyboardSelect
+	Balloon   chan BalloonEvent  // requires Windows XP or later
+	Menu      chan MenuEvent
+	HotKey    chan HotKeyEvent
+
+	// ShowTimeout specifies how long to wait for the balloon to be shown
+	// after Notify if it is greater than 0. BalloonSuppressed is sent to the
+	// Balloon if the shell does not show the balloon within it, e.g. when it
+	// is suppressed by the quiet time or focus assist.
+	ShowTimeout time.Duration
+
+	// MaxQueue specifies the maximum number of notifications which wait for
+	// the current balloon to be closed if it is greater than 0, so they are
+	// shown one at a time in order. Notify replaces the current balloon
+	// otherwise. DropPolicy specifies which notification is discarded when
+	// the queue is full.
+	//
+	// The ShowTimeout defaults to 30 seconds when the queue is used, so that
+	// a balloon which is never shown does not block the queue.
+	MaxQueue   int
+	DropPolicy DropPolicy
+
+	name    string
+	wnd     windows.Handle
+	menu    *Menu
+	hotkeys map[int32]struct{} // accessed by the window thread
+	wg      sync.WaitGroup
+	err     chan error
+
+	tmu   sync.Mutex
+	timer *time.Timer
+	seq   uintptr
+	cur   uintptr // token of the current balloon, or 0
+	shown bool
+	url   string // OnClickURL of the current balloon
 
-	name string
-	wnd  windows.Handle
-	menu *Menu
-	wg   sync.WaitGroup
-	err  chan error
+	qmu     sync.Mutex
+	queue   []*balloon
+	showing bool
 
 	mu    sync.Mutex
 	data  sys.NotifyIconData
@@ -91,12 +150,15 @@ type NotifyIcon struct {
 // New returns a new NotifyIcon.
 func New(name string) (ni *NotifyIcon, err error) {
 	ni = &NotifyIcon{
-		Balloon: make(chan BalloonEvent),
-		Menu:    make(chan MenuEvent),
-		name:    name,
-		err:     make(chan error, 1),
-		ev:      make(chan interface{}),
-		done:    make(chan struct{}),
+		Activate: make(chan ActivateEvent),
+		Balloon:  make(chan BalloonEvent),
+		Menu:     make(chan MenuEvent),
+		HotKey:   make(chan HotKeyEvent),
+		name:     name,
+		hotkeys:  make(map[int32]struct{}),
+		err:      make(chan error, 1),
+		ev:       make(chan interface{}),
+		done:     make(chan struct{}),
 	}
 	// shell32.dll version
 	switch {
@@ -168,17 +230,59 @@ func (ni *NotifyIcon) Modify() error {
 	ni.mu.Lock()
 	defer ni.mu.Unlock()
 
+	return ni.modify()
+}
+
+func (ni *NotifyIcon) modify() error {
 	if err := ni.prepare(); err != nil {
 		return err
 	}
-	return sys.Shell_NotifyIcon(sys.NIM_MODIFY, &ni.data)
+	return shellNotifyIcon(sys.NIM_MODIFY, &ni.data)
+}
+
+// SetTip updates the tooltip and the icon of the NotifyIcon without
+// displaying a notification. It adds the NotifyIcon to the notification area
+// if it has not been added yet.
+//
+// The tooltip is also announced as the accessible name of the NotifyIcon by
+// screen readers, because NOTIFYICONDATA has no separate field for it. An
+// accessible name distinct from the tooltip is not supported.
+func (ni *NotifyIcon) SetTip(tip string) error {
+	u, err := windows.UTF16FromString(tip)
+	if err != nil {
+		return err
+	}
+
+	ni.mu.Lock()
+	defer ni.mu.Unlock()
+
+	if err := ni.prepare(); err != nil {
+		return err
+	}
+	ni.data.Flags |= sys.NIF_TIP
+	ni.data.Tip = [len(ni.data.Tip)]uint16{}
+	copy(ni.data.Tip[:len(ni.data.Tip)-1], u)
+	if atomic.LoadInt32(&ni.added) == 0 {
+		return ni.add(&ni.data)
+	}
+	return shellNotifyIcon(sys.NIM_MODIFY, &ni.data)
 }
 
 func (ni *NotifyIcon) prepare() error {
+	icon := ni.Icon
+	if ni.LightIcon != nil || ni.DarkIcon != nil {
+		if usesLightTheme() {
+			if ni.LightIcon != nil {
+				icon = ni.LightIcon
+			}
+		} else if ni.DarkIcon != nil {
+			icon = ni.DarkIcon
+		}
+	}
 	switch {
-	case ni.Icon != nil:
+	case icon != nil:
 		ni.data.Flags |= sys.NIF_ICON
-		ni.data.Icon = ni.Icon.h
+		ni.data.Icon = icon.h
 	case ni.data.Flags&sys.NIF_ICON != 0:
 		ni.data.Flags ^= sys.NIF_ICON
 		ni.data.Icon = 0
@@ -208,13 +312,186 @@ func (ni *NotifyIcon) prepare() error {
 
 // Notify displays a notification.
 func (ni *NotifyIcon) Notify(n *Notification) error {
+	if n.OnClickURL != "" {
+		u, err := url.Parse(n.OnClickURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return ErrURL
+		}
+	}
+	data, err := ni.info(n)
+	if err != nil {
+		return err
+	}
+	b := &balloon{
+		data: data,
+		url:  n.OnClickURL,
+	}
+
+	if ni.MaxQueue > 0 {
+		ni.qmu.Lock()
+		if ni.showing {
+			defer ni.qmu.Unlock()
+
+			if len(ni.queue) >= ni.MaxQueue {
+				if ni.DropPolicy == DropNewest {
+					return ErrQueue
+				}
+				ni.queue = ni.queue[:copy(ni.queue, ni.queue[1:])]
+			}
+			ni.queue = append(ni.queue, b)
+			return nil
+		}
+		ni.showing = true
+		ni.qmu.Unlock()
+	}
+	err = ni.show(b)
+	if err != nil {
+		ni.qmu.Lock()
+		ni.showing = false
+		ni.qmu.Unlock()
+	}
+	return err
+}
+
+// balloon represents a notification which is shown or queued.
+type balloon struct {
+	data sys.NotifyIconData
+	url  string
+}
+
+func (ni *NotifyIcon) show(b *balloon) (err error) {
+	if atomic.LoadInt32(&ni.added) == 0 {
+		err = ni.add(&b.data)
+	} else {
+		err = shellNotifyIcon(sys.NIM_MODIFY, &b.data)
+	}
+	if err == nil {
+		ni.begin(b.url)
+	}
+	return
+}
+
+// begin makes the balloon which has been passed to the shell the current one
+// with a new token.
+func (ni *NotifyIcon) begin(url string) {
+	ni.tmu.Lock()
+	defer ni.tmu.Unlock()
+
+	ni.seq++
+	ni.cur = ni.seq
+	ni.shown = false
+	ni.url = url
+	ni.awaitShow(ni.cur)
+}
+
+// balloonShown is called when a balloon is shown, and stops the timer of the
+// current balloon.
+func (ni *NotifyIcon) balloonShown() {
+	ni.tmu.Lock()
+	defer ni.tmu.Unlock()
+
+	if ni.cur != 0 {
+		ni.shown = true
+		ni.stopAwaitShow()
+	}
+}
+
+// suppressed reports whether the balloon of the specified token is still
+// the current one and has not been shown yet. It is ended if so.
+func (ni *NotifyIcon) suppressed(token uintptr) bool {
+	ni.tmu.Lock()
+	defer ni.tmu.Unlock()
+
+	if token != ni.cur || ni.shown {
+		return false
+	}
+	ni.end()
+	return true
+}
+
+// end ends the current balloon. It must be called with tmu held.
+func (ni *NotifyIcon) end() string {
+	url := ni.url
+	ni.cur = 0
+	ni.shown = false
+	ni.url = ""
+	ni.stopAwaitShow()
+	return url
+}
+
+// closed is called when a balloon is closed. If it is the current balloon,
+// its OnClickURL is opened if it is clicked, and the next notification in
+// the queue is shown. Otherwise it is stale and ignored.
+func (ni *NotifyIcon) closed(clicked bool) {
+	ni.tmu.Lock()
+	if ni.cur == 0 {
+		ni.tmu.Unlock()
+		return
+	}
+	url := ni.end()
+	ni.tmu.Unlock()
+	if clicked && url != "" {
+		verb, _ := windows.UTF16PtrFromString("open")
+		file, err := windows.UTF16PtrFromString(url)
+		if err == nil {
+			shellExecute(ni.wnd, verb, file, nil, nil, windows.SW_SHOWNORMAL)
+		}
+	}
+	ni.next()
+}
+
+// next shows the first notification in the queue after the current balloon
+// is closed.
+func (ni *NotifyIcon) next() {
+	ni.qmu.Lock()
+	defer ni.qmu.Unlock()
+
+	for len(ni.queue) > 0 {
+		b := ni.queue[0]
+		ni.queue = ni.queue[:copy(ni.queue, ni.queue[1:])]
+		if ni.show(b) == nil {
+			return
+		}
+	}
+	ni.showing = false
+}
+
+// defaultShowTimeout is the ShowTimeout when the queue is used.
+const defaultShowTimeout = 30 * time.Second
+
+// awaitShow starts the timer to post wmShowTimeout with the token of the
+// balloon if ShowTimeout is greater than 0, so that it is handled in order
+// with the balloon messages from the shell. It must be called with tmu held.
+func (ni *NotifyIcon) awaitShow(token uintptr) {
+	ni.stopAwaitShow()
+	d := ni.ShowTimeout
+	if d <= 0 && ni.MaxQueue > 0 {
+		d = defaultShowTimeout
+	}
+	if d > 0 {
+		ni.timer = time.AfterFunc(d, func() {
+			sys.PostMessage(ni.wnd, wmShowTimeout, token, 0)
+		})
+	}
+}
+
+// stopAwaitShow stops the timer which was started by awaitShow. It must be
+// called with tmu held.
+func (ni *NotifyIcon) stopAwaitShow() {
+	if ni.timer != nil {
+		ni.timer.Stop()
+		ni.timer = nil
+	}
+}
+
+func (ni *NotifyIcon) info(n *Notification) (data sys.NotifyIconData, err error) {
 	// copy
 	ni.mu.Lock()
-	if err := ni.prepare(); err != nil {
+	if err = ni.prepare(); err != nil {
 		ni.mu.Unlock()
-		return err
+		return
 	}
-	data := ni.data
+	data = ni.data
 	ni.mu.Unlock()
 
 	if testHookNotify != nil {
@@ -224,12 +501,12 @@ func (ni *NotifyIcon) Notify(n *Notification) error {
 	data.Flags |= sys.NIF_INFO
 	u, err := windows.UTF16FromString(n.Title)
 	if err != nil {
-		return err
+		return
 	}
 	copy(data.InfoTitle[:], u)
-	u, err = windows.UTF16FromString(n.Body)
+	u, err = windows.UTF16FromString(sanitizer.Replace(n.Body))
 	if err != nil {
-		return err
+		return
 	}
 	copy(data.Info[:], u)
 	// icon
@@ -238,43 +515,105 @@ func (ni *NotifyIcon) Notify(n *Notification) error {
 		data.InfoFlags |= uint32(n.IconType)
 	case IconUser:
 		if !isWindowsXPSP2OrGreater() {
-			return VersionError("XP SP2")
+			err = VersionError("XP SP2")
+			return
 		}
 		data.InfoFlags |= uint32(n.IconType)
 		if n.Icon != nil {
 			if !isShellDLLVersionOrGreater(6, 0, 6) {
-				return VersionError("Vista")
+				err = VersionError("Vista")
+				return
 			}
 			data.BalloonIcon = n.Icon.h
 		}
 	default:
-		return ErrIcon
+		err = ErrIcon
+		return
 	}
 	// sound
-	if !n.Sound {
-		if !isShellDLLVersionOrGreater(6, 0, 0) {
-			return VersionError("XP")
-		}
+	if !n.Sound && isShellDLLVersionOrGreater(6, 0, 0) {
 		data.InfoFlags |= sys.NIIF_NOSOUND
 	}
-
-	if atomic.LoadInt32(&ni.added) == 0 {
-		return ni.add(&data)
+	// timeout
+	if n.Timeout > 0 && !isShellDLLVersionOrGreater(6, 0, 6) {
+		// uTimeout shares the field with uVersion
+		data.Version = uint32(min(max(n.Timeout, minBalloonTimeout), maxBalloonTimeout) / time.Millisecond)
 	}
-	return sys.Shell_NotifyIcon(sys.NIM_MODIFY, &data)
+	return
 }
 
 func (ni *NotifyIcon) add(data *sys.NotifyIconData) error {
-	err := sys.Shell_NotifyIcon(sys.NIM_ADD, data)
+	err := shellNotifyIcon(sys.NIM_ADD, data)
 	if err == nil {
-		if data.Version != 0 {
-			sys.Shell_NotifyIcon(sys.NIM_SETVERSION, data)
+		// data.Version may be the uTimeout of a balloon
+		if ni.data.Version != 0 {
+			v := *data
+			v.Version = ni.data.Version
+			shellNotifyIcon(sys.NIM_SETVERSION, &v)
 		}
 		atomic.StoreInt32(&ni.added, 1)
 	}
 	return err
 }
 
+// Handle returns the handle of the hidden window which receives the messages
+// for the NotifyIcon.
+//
+// This is intended for advanced use such as subclassing the window. Messages
+// sent to it must not conflict with the ones used by the NotifyIcon, and the
+// handle is invalid after Close.
+func (ni *NotifyIcon) Handle() windows.Handle {
+	return ni.wnd
+}
+
+// RegisterHotKey registers the system-wide hotkey which is the combination of
+// the specified modifiers and the virtual-key code vk. HotKeyEvent is sent to
+// the HotKey when it is pressed.
+//
+// The id must be in the range of 0x0000 to 0xbfff, and it is reported as the
+// ID of the HotKeyEvent. It returns an error if the hotkey is already
+// registered by another application.
+func (ni *NotifyIcon) RegisterHotKey(id uint16, mod Modifier, vk uint16) error {
+	if id > 0xbfff {
+		return ErrHotKeyID
+	}
+	if isWindows7OrGreater() {
+		mod |= sys.MOD_NOREPEAT
+	}
+	return ni.sendMessage(wmRegisterHotKey, uintptr(id), uintptr(uint32(vk)<<16|uint32(uint16(mod))))
+}
+
+// UnregisterHotKey unregisters the hotkey which was registered by
+// RegisterHotKey.
+func (ni *NotifyIcon) UnregisterHotKey(id uint16) error {
+	return ni.sendMessage(wmUnregisterHotKey, uintptr(id), 0)
+}
+
+// sendMessage sends the message to the window of the NotifyIcon, and
+// returns ERROR_INVALID_WINDOW_HANDLE after Close.
+func (ni *NotifyIcon) sendMessage(msg uint32, wParam, lParam uintptr) error {
+	select {
+	case <-ni.done:
+		return windows.ERROR_INVALID_WINDOW_HANDLE
+	default:
+	}
+	return result(sys.SendMessage(ni.wnd, msg, wParam, lParam))
+}
+
+func errno(err error) windows.Errno {
+	if errno, ok := err.(windows.Errno); ok && errno != 0 {
+		return errno
+	}
+	return windows.ERROR_INVALID_FUNCTION
+}
+
+func result(res uintptr) error {
+	if res != 0 {
+		return windows.Errno(res)
+	}
+	return nil
+}
+
 // CreateMenu creates a new context menu.
 func (ni *NotifyIcon) CreateMenu() *Menu {
 	ni.menu = new(Menu)
@@ -284,16 +623,26 @@ func (ni *NotifyIcon) CreateMenu() *Menu {
 func (ni *NotifyIcon) event() {
 	defer ni.wg.Done()
 
+	var activate chan ActivateEvent
 	var balloon chan BalloonEvent
 	var menu chan MenuEvent
-	var balloonIdx, menuIdx int
+	var hotkey chan HotKeyEvent
+	var activateIdx, balloonIdx, menuIdx, hotkeyIdx int
+	activateBuf := make([]ActivateEvent, 1)
 	balloonBuf := make([]BalloonEvent, 1)
 	menuBuf := make([]MenuEvent, 1)
+	hotkeyBuf := make([]HotKeyEvent, 1)
 
 	for {
 		select {
 		case ev := <-ni.ev:
 			switch ev := ev.(type) {
+			case ActivateEvent:
+				if activate == nil {
+					activate = ni.Activate
+					activateIdx = 1
+				}
+				activateBuf = append(activateBuf, ev)
 			case BalloonEvent:
 				if balloon == nil {
 					balloon = ni.Balloon
@@ -306,6 +655,20 @@ func (ni *NotifyIcon) event() {
 					menuIdx = 1
 				}
 				menuBuf = append(menuBuf, ev)
+			case HotKeyEvent:
+				if hotkey == nil {
+					hotkey = ni.HotKey
+					hotkeyIdx = 1
+				}
+				hotkeyBuf = append(hotkeyBuf, ev)
+			}
+		case activate <- activateBuf[activateIdx]:
+			if activateIdx == len(activateBuf)-1 {
+				activate = nil
+				activateIdx = 0
+				activateBuf = activateBuf[:1]
+			} else {
+				activateIdx++
 			}
 		case balloon <- balloonBuf[balloonIdx]:
 			if balloonIdx == len(balloonBuf)-1 {
@@ -323,6 +686,14 @@ func (ni *NotifyIcon) event() {
 			} else {
 				menuIdx++
 			}
+		case hotkey <- hotkeyBuf[hotkeyIdx]:
+			if hotkeyIdx == len(hotkeyBuf)-1 {
+				hotkey = nil
+				hotkeyIdx = 0
+				hotkeyBuf = hotkeyBuf[:1]
+			} else {
+				hotkeyIdx++
+			}
 		case <-ni.done:
 			return
 		}
@@ -366,24 +737,50 @@ func (ni *NotifyIcon) windowProc(wnd windows.Handle, msg uint32, wParam, lParam
 	case sys.WM_DESTROY:
 		var err error
 		if atomic.LoadInt32(&ni.added) != 0 {
-			err = sys.Shell_NotifyIcon(sys.NIM_DELETE, &ni.data)
+			err = shellNotifyIcon(sys.NIM_DELETE, &ni.data)
 		}
+		for id := range ni.hotkeys {
+			sys.UnregisterHotKey(wnd, id)
+		}
+		ni.tmu.Lock()
+		ni.end()
+		ni.tmu.Unlock()
+		ni.qmu.Lock()
+		ni.queue = nil
+		ni.qmu.Unlock()
 		close(ni.done)
 		sys.PostQuitMessage(0)
 		ni.err <- err
 	case sys.WM_USER:
 		switch sys.LoWord(uint32(lParam)) {
+		case sys.NIN_SELECT:
+			if ni.data.Version != 0 {
+				ni.ev <- ActivateEvent{Kind: LeftClick}
+			}
+		case sys.NIN_KEYSELECT:
+			ni.ev <- ActivateEvent{Kind: KeyboardSelect}
+		case sys.WM_LBUTTONUP:
+			// NIN_SELECT is sent instead
+			if ni.data.Version == 0 {
+				ni.ev <- ActivateEvent{Kind: LeftClick}
+			}
+		case sys.WM_LBUTTONDBLCLK:
+			ni.ev <- ActivateEvent{Kind: DoubleClick}
 		case sys.WM_RBUTTONUP:
 			if ni.menu != nil {
 				sys.PostMessage(wnd, sys.WM_CONTEXTMENU, 0, 0)
 			}
 		case sys.NIN_BALLOONSHOW:
+			ni.balloonShown()
 			ni.ev <- BalloonShown
 		case sys.NIN_BALLOONHIDE:
+			ni.closed(false)
 			ni.ev <- BalloonClosed
 		case sys.NIN_BALLOONTIMEOUT:
+			ni.closed(false)
 			ni.ev <- BalloonClosed
 		case sys.NIN_BALLOONUSERCLICK:
+			ni.closed(true)
 			ni.ev <- BalloonClicked
 		}
 	case sys.WM_CONTEXTMENU:
@@ -399,15 +796,71 @@ func (ni *NotifyIcon) windowProc(wnd windows.Handle, msg uint32, wParam, lParam
 		sys.PostMessage(wnd, sys.WM_NULL, 0, 0)
 	case sys.WM_COMMAND:
 		ni.ev <- MenuEvent{ID: sys.LoWord(uint32(wParam))}
+	case sys.WM_HOTKEY:
+		ni.ev <- HotKeyEvent{
+			ID:        uint16(wParam),
+			Modifiers: Modifier(sys.LoWord(uint32(lParam))),
+			Key:       sys.HiWord(uint32(lParam)),
+		}
+	case wmRegisterHotKey:
+		// hotkeys must be registered by the thread which created the window
+		id := int32(wParam)
+		if err := sys.RegisterHotKey(wnd, id, uint32(sys.LoWord(uint32(lParam))), uint32(sys.HiWord(uint32(lParam)))); err != nil {
+			return uintptr(errno(err))
+		}
+		ni.hotkeys[id] = struct{}{}
+	case wmUnregisterHotKey:
+		id := int32(wParam)
+		if err := sys.UnregisterHotKey(wnd, id); err != nil {
+			return uintptr(errno(err))
+		}
+		delete(ni.hotkeys, id)
+	case wmShowTimeout:
+		// stale if the balloon is shown or closed before
+		if ni.suppressed(wParam) {
+			ni.ev <- BalloonSuppressed
+			ni.next()
+		}
+	case wmModify:
+		// Close holds ni.mu while it waits for the window thread, so it is
+		// retried after WM_CLOSE if ni.mu is held
+		if !ni.mu.TryLock() {
+			sys.PostMessage(wnd, wmModify, 0, 0)
+			break
+		}
+		ni.modify()
+		ni.mu.Unlock()
+	case sys.WM_SETTINGCHANGE:
+		if (ni.LightIcon != nil || ni.DarkIcon != nil) && lParam != 0 && atomic.LoadInt32(&ni.added) != 0 {
+			if windows.UTF16PtrToString((*uint16)(unsafe.Pointer(lParam))) == "ImmersiveColorSet" {
+				sys.PostMessage(wnd, wmModify, 0, 0)
+			}
+		}
+		return sys.DefWindowProc(wnd, msg, wParam, lParam)
 	case sys.WM_SYSKEYDOWN:
 		// disable Alt+F4
 	default:
 		if msg == _WM_TASKBARCREATED {
-			if ni.Modify() != nil {
+			// see wmModify
+			if !ni.mu.TryLock() {
+				sys.PostMessage(wnd, msg, wParam, lParam)
+				break
+			}
+			var err error
+			recreated := ni.modify() != nil
+			if recreated {
 				atomic.StoreInt32(&ni.added, 0)
-				if err := ni.Add(); err != nil {
+				if err = ni.prepare(); err == nil {
+					err = ni.add(&ni.data)
+				}
+			}
+			ni.mu.Unlock()
+			if recreated {
+				if err != nil {
 					panic(err)
 				}
+				// the current balloon is lost
+				ni.closed(false)
 			}
 		}
 		return sys.DefWindowProc(wnd, msg, wParam, lParam)
@@ -428,15 +881,104 @@ func windowProc(wnd windows.Handle, msg uint32, wParam, lParam uintptr) uintptr
 	return sys.DefWindowProc(wnd, msg, wParam, lParam)
 }
 
+// systemUsesLightTheme reports whether the taskbar uses the light theme.
+func systemUsesLightTheme() bool {
+	k, err := registry.OpenKey(registry.CURRENT_USER, `Software\Microsoft\Windows\CurrentVersion\Themes\Personalize`, registry.QUERY_VALUE)
+	if err != nil {
+		return false
+	}
+	defer k.Close()
+
+	v, _, err := k.GetIntegerValue("SystemUsesLightTheme")
+	return err == nil && v != 0
+}
+
+// IsServiceRunning reports whether the Windows Push Notifications User
+// Service, which displays notifications on Windows 10 or later, is running.
+// It always reports true if the service does not exist.
+func IsServiceRunning() (bool, error) {
+	m, err := windows.OpenSCManager(nil, nil, windows.SC_MANAGER_CONNECT|windows.SC_MANAGER_ENUMERATE_SERVICE)
+	if err != nil {
+		return false, err
+	}
+	defer windows.CloseServiceHandle(m)
+
+	var b []byte
+	var needed, n uint32
+	for {
+		var p *byte
+		if len(b) != 0 {
+			p = &b[0]
+		}
+		err = windows.EnumServicesStatusEx(m, windows.SC_ENUM_PROCESS_INFO, windows.SERVICE_WIN32|sys.SERVICE_USER_SERVICE, windows.SERVICE_STATE_ALL, p, uint32(len(b)), &needed, &n, nil, nil)
+		if err == nil {
+			break
+		} else if err != windows.ERROR_MORE_DATA || needed <= uint32(len(b)) {
+			return false, err
+		}
+		b = make([]byte, needed)
+	}
+	if n == 0 {
+		return true, nil
+	}
+	return isServiceRunning(unsafe.Slice((*windows.ENUM_SERVICE_STATUS_PROCESS)(unsafe.Pointer(&b[0])), n)), nil
+}
+
+// isServiceRunning reports whether any of the per-user instances of the
+// Windows Push Notifications User Service in services is running, or none of
+// them exists.
+func isServiceRunning(services []windows.ENUM_SERVICE_STATUS_PROCESS) bool {
+	var found bool
+	for _, s := range services {
+		if strings.HasPrefix(windows.UTF16PtrToString(s.ServiceName), "WpnUserService") {
+			if s.ServiceStatusProcess.CurrentState == windows.SERVICE_RUNNING {
+				return true
+			}
+			found = true
+		}
+	}
+	return !found
+}
+
 // Notification represents a notification.
+//
+// The Body can contain multiple lines separated by "\n". "\r\n" is
+// normalized to "\n", and a lone "\r" is replaced with a space.
+//
+// The Notification is always displayed as a balloon of the NotifyIcon, and
+// the source of it cannot be specified per Notification. The classic balloon
+// shows it near the notification icon which has the name of the NotifyIcon
+// as its tooltip. On Windows 10 or later, the shell displays the balloon as
+// a toast and the application name is determined by the shell from the
+// executable, not by the NotifyIcon.
+//
+// The Timeout specifies how long the balloon is displayed, and it is clamped
+// to the range from 10 to 30 seconds. It is only honored on Windows 2000 and
+// Windows XP, and ignored on Windows Vista or later, where the duration is
+// determined by the accessibility settings of the system.
 type Notification struct {
 	Title    string
 	Body     string
 	IconType IconType
 	Icon     *Icon // requires Windows Vista or later
-	Sound    bool
+	Sound    bool  // false is ignored before Windows XP
+	Timeout  time.Duration
+
+	// OnClickURL is opened by the default browser when the balloon is
+	// clicked if it is not empty. It must be an http or https URL.
+	OnClickURL string
 }
 
+const (
+	minBalloonTimeout = 10 * time.Second
+	maxBalloonTimeout = 30 * time.Second
+)
+
+var sanitizer = strings.NewReplacer(
+	"\r\n", "\n",
+	"\r", " ",
+)
+
 // IconType represents an icon type of the Notification.
 type IconType uint8
 
@@ -455,6 +997,9 @@ type Icon struct {
 }
 
 // LoadImage returns a new Icon from the specified img.
+//
+// It converts the pixels and creates bitmaps synchronously, so it may take a
+// while for a large img. See LoadImageAsync to avoid blocking.
 func LoadImage(img image.Image) (icon *Icon, err error) {
 	img, err = util.Convert(img)
 	if err != nil {
@@ -462,65 +1007,64 @@ func LoadImage(img image.Image) (icon *Icon, err error) {
 	}
 	size := img.Bounds().Size()
 
+	// 32-bit top-down DIBs
+	mbits := make([]byte, size.X*size.Y*4)
+	cbits := make([]byte, size.X*size.Y*4)
+	switch img := img.(type) {
+	case *image.Gray:
+		for y := 0; y < size.Y; y++ {
+			i := y * size.X * 4
+			for _, v := range img.Pix[y*img.Stride : y*img.Stride+size.X] {
+				cbits[i], cbits[i+1], cbits[i+2] = v, v, v
+				i += 4
+			}
+		}
+	case *image.NRGBA:
+		for y := 0; y < size.Y; y++ {
+			i := y * size.X * 4
+			p := img.Pix[y*img.Stride : y*img.Stride+size.X*4]
+			for j := 0; j < len(p); j += 4 {
+				a := 255 - p[j+3]
+				mbits[i], mbits[i+1], mbits[i+2] = a, a, a
+				cbits[i], cbits[i+1], cbits[i+2] = p[j+2], p[j+1], p[j]
+				i += 4
+			}
+		}
+	}
+	bi := sys.BitmapInfo{
+		Header: sys.BitmapInfoHeader{
+			Width:       int32(size.X),
+			Height:      -int32(size.Y),
+			Planes:      1,
+			BitCount:    32,
+			Compression: sys.BI_RGB,
+		},
+	}
+	bi.Header.Size = uint32(unsafe.Sizeof(bi.Header))
+
 	dc, err := sys.GetDC(0)
 	if err != nil {
 		return
 	}
 	defer sys.ReleaseDC(0, dc)
 	// bitmask bitmap
-	mdc1, err := sys.CreateCompatibleDC(dc)
-	if err != nil {
-		return
-	}
-	defer sys.DeleteDC(mdc1)
 	mask, err := sys.CreateCompatibleBitmap(dc, int32(size.X), int32(size.Y))
 	if err != nil {
 		return
 	}
 	defer sys.DeleteObject(mask)
-	obj1, err := sys.SelectObject(mdc1, mask)
-	if err != nil {
+	if _, err = sys.SetDIBits(dc, mask, 0, uint32(size.Y), unsafe.Pointer(unsafe.SliceData(mbits)), &bi, sys.DIB_RGB_COLORS); err != nil {
 		return
 	}
-	defer sys.SelectObject(mdc1, obj1)
 	// color bitmap
-	mdc2, err := sys.CreateCompatibleDC(dc)
-	if err != nil {
-		return
-	}
-	defer sys.DeleteDC(mdc2)
 	bm, err := sys.CreateCompatibleBitmap(dc, int32(size.X), int32(size.Y))
 	if err != nil {
 		return
 	}
 	defer sys.DeleteObject(bm)
-	obj2, err := sys.SelectObject(mdc2, bm)
-	if err != nil {
+	if _, err = sys.SetDIBits(dc, bm, 0, uint32(size.Y), unsafe.Pointer(unsafe.SliceData(cbits)), &bi, sys.DIB_RGB_COLORS); err != nil {
 		return
 	}
-	defer sys.SelectObject(mdc2, obj2)
-
-	switch img := img.(type) {
-	case *image.Gray:
-		for y := 0; y < size.Y; y++ {
-			for x := 0; x < size.X; x++ {
-				c := img.GrayAt(x, y)
-				sys.SetPixel(mdc2, int32(x), int32(y), sys.RGB(c.Y, c.Y, c.Y))
-			}
-		}
-	case *image.NRGBA:
-		for y := 0; y < size.Y; y++ {
-			for x := 0; x < size.X; x++ {
-				c := img.NRGBAAt(x, y)
-				a := 255 - c.A
-				sys.SetPixel(mdc1, int32(x), int32(y), sys.RGB(a, a, a))
-				sys.SetPixel(mdc2, int32(x), int32(y), sys.RGB(c.R, c.G, c.B))
-			}
-		}
-	}
-	// deselect from device context
-	sys.SelectObject(mdc1, obj1)
-	sys.SelectObject(mdc2, obj2)
 	h, err := sys.CreateIconIndirect(&sys.IconInfo{
 		Icon:     1,
 		XHotspot: 0,
@@ -535,13 +1079,50 @@ func LoadImage(img image.Image) (icon *Icon, err error) {
 	return
 }
 
+// IconResult represents the result of LoadImageAsync.
+type IconResult struct {
+	Icon *Icon
+	Err  error
+}
+
+// LoadImageAsync is like LoadImage but loads the Icon in a new goroutine.
+// The returned channel receives the result, and then it is closed. This
+// allows to show the NotifyIcon with a placeholder Icon first, and replace
+// it by Modify later.
+func LoadImageAsync(img image.Image) <-chan IconResult {
+	ch := make(chan IconResult, 1)
+	go func() {
+		defer close(ch)
+
+		icon, err := LoadImage(img)
+		ch <- IconResult{
+			Icon: icon,
+			Err:  err,
+		}
+	}()
+	return ch
+}
+
 // LoadIcon returns a new Icon from the specified icon resource.
-func LoadIcon(i uint16) (icon *Icon, err error) {
+func LoadIcon(i uint16) (*Icon, error) {
+	return loadIconSize(i, 0, sys.LR_DEFAULTSIZE)
+}
+
+// LoadIconSize is like LoadIcon but returns a new Icon which is rasterized at
+// the specified size in pixels. The size must be in the range of 1 to 256.
+func LoadIconSize(i uint16, size int) (*Icon, error) {
+	if size < 1 || 256 < size {
+		return nil, ErrIconSize
+	}
+	return loadIconSize(i, int32(size), 0)
+}
+
+func loadIconSize(i uint16, size int32, flags uint32) (icon *Icon, err error) {
 	inst, err := sys.GetModuleHandle(nil)
 	if err != nil {
 		return
 	}
-	h, err := loadImage(inst, sys.MakeIntResource(i), sys.IMAGE_ICON, 0, 0, sys.LR_DEFAULTSIZE)
+	h, err := loadImage(inst, sys.MakeIntResource(i), sys.IMAGE_ICON, size, size, flags)
 	if err == nil {
 		icon = &Icon{h: h}
 	}
@@ -632,6 +1213,27 @@ Error:
 	return windows.GUID{}, ErrGUID
 }
 
+// ActivateEvent represents an activation of the NotifyIcon.
+type ActivateEvent struct {
+	Kind ActivateKind
+}
+
+// ActivateKind represents how the NotifyIcon is activated.
+type ActivateKind uint
+
+// List of kinds for the ActivateEvent.
+const (
+	// LeftClick represents the NIN_SELECT message, or the WM_LBUTTONUP
+	// message on shell32.dll older than version 5.0.
+	LeftClick ActivateKind = iota
+
+	// DoubleClick represents the WM_LBUTTONDBLCLK message.
+	DoubleClick
+
+	// KeyboardSelect represents the NIN_KEYSELECT message.
+	KeyboardSelect
+)
+
 // BalloonEvent represents an event of the notification balloon.
 type BalloonEvent uint
 
@@ -645,6 +1247,24 @@ const (
 
 	// BalloonClicked represents the NIN_BALLOONUSERCLICK message.
 	BalloonClicked
+
+	// BalloonSuppressed represents that the NIN_BALLOONSHOW message was not
+	// received within the ShowTimeout of the NotifyIcon.
+	BalloonSuppressed
+)
+
+// DropPolicy represents which notification is discarded when the queue of
+// the NotifyIcon is full.
+type DropPolicy uint
+
+// List of drop policies for the queue of the NotifyIcon.
+const (
+	// DropOldest discards the oldest notification in the queue.
+	DropOldest DropPolicy = iota
+
+	// DropNewest discards the notification which is being queued, and
+	// Notify returns ErrQueue.
+	DropNewest
 )
 
 // Menu represents a context menu of the NotifyIcon.
@@ -653,6 +1273,9 @@ type Menu struct {
 }
 
 // Item appends an item to the context menu.
+//
+// The id must be in the range of uint16, because it is reported as the ID of
+// the MenuEvent.
 func (m *Menu) Item(text string, id uint) {
 	m.items = append(m.items, menuItem{
 		text:  text,
@@ -694,6 +1317,10 @@ func (m *Menu) sys() (windows.Handle, error) {
 			}
 			item = uintptr(sub)
 		} else {
+			if mi.id > math.MaxUint16 {
+				sys.DestroyMenu(menu)
+				return 0, ErrMenuID
+			}
 			item = uintptr(mi.id)
 		}
 		p, err := windows.UTF16PtrFromString(mi.text)
@@ -716,6 +1343,24 @@ type menuItem struct {
 	menu  *Menu
 }
 
+// HotKeyEvent represents an event of the hotkey.
+type HotKeyEvent struct {
+	ID        uint16
+	Modifiers Modifier
+	Key       uint16 // virtual-key code
+}
+
+// Modifier represents a modifier key of the hotkey.
+type Modifier uint16
+
+// List of modifier keys for the hotkey.
+const (
+	ModAlt     Modifier = sys.MOD_ALT
+	ModControl Modifier = sys.MOD_CONTROL
+	ModShift   Modifier = sys.MOD_SHIFT
+	ModWin     Modifier = sys.MOD_WIN
+)
+
 // MenuEvent represents an event of the context menu.
 type MenuEvent struct {
 	ID uint16
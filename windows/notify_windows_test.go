@@ -1,7 +1,7 @@
 //
 // go.notify/windows :: notify_windows_test.go
 //
-//   Copyright (c) 2017-2021 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2017-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -11,6 +11,7 @@ package windows_test
 import (
 	"image"
 	_ "image/png"
+	"math"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -131,6 +132,18 @@ func TestClose(t *testing.T) {
 	}
 }
 
+func TestHandle(t *testing.T) {
+	ni, err := windows.New(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ni.Close()
+
+	if ni.Handle() == 0 {
+		t.Error("expected non-zero handle")
+	}
+}
+
 func TestPrepare(t *testing.T) {
 	ni, err := windows.New(name)
 	if err != nil {
@@ -178,6 +191,51 @@ func TestPrepare(t *testing.T) {
 	}
 }
 
+func TestPrepareThemeIcon(t *testing.T) {
+	ni, err := windows.New(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ni.Close()
+
+	var icons []*windows.Icon
+	for i := 0; i < 3; i++ {
+		icon, err := windows.LoadImage(image.NewGray(image.Rect(0, 0, 16, 16)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer icon.Close()
+		icons = append(icons, icon)
+	}
+	ni.Icon = icons[0]
+	for _, tt := range []struct {
+		light, dark *windows.Icon
+		theme       bool
+		e           *windows.Icon
+	}{
+		{icons[1], icons[2], true, icons[1]},
+		{icons[1], icons[2], false, icons[2]},
+		{icons[1], nil, true, icons[1]},
+		{icons[1], nil, false, icons[0]},
+		{nil, icons[2], true, icons[0]},
+		{nil, icons[2], false, icons[2]},
+	} {
+		ni.LightIcon = tt.light
+		ni.DarkIcon = tt.dark
+		windows.MockLightTheme(tt.theme)
+		if err := ni.Prepare(sys.NotifyIconData{}); err != nil {
+			t.Fatal(err)
+		}
+		data := ni.Data()
+		if data.Flags&sys.NIF_ICON == 0 {
+			t.Error("NIF_ICON is not set")
+		}
+		if g, e := data.Icon, tt.e.Handle(); g != e {
+			t.Errorf("light theme = %v: expected %v, got %v", tt.theme, e, g)
+		}
+	}
+}
+
 func TestAdd(t *testing.T) {
 	ni, err := windows.New(name)
 	if err != nil {
@@ -239,6 +297,41 @@ func TestModify(t *testing.T) {
 	}
 }
 
+func TestSetTip(t *testing.T) {
+	ni, err := windows.New(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ni.Close()
+
+	icon, err := load()
+	if err != nil {
+		t.Error(err)
+	}
+	defer icon.Close()
+
+	ni.Icon = icon
+	for _, tip := range []string{"Connecting", "Connected"} {
+		if err := ni.SetTip(tip); err != nil {
+			t.Fatal(err)
+		}
+		data := ni.Data()
+		if g, e := syscall.UTF16ToString(data.Tip[:]), tip; g != e {
+			t.Errorf("expected %q, got %q", e, g)
+		}
+		if data.Flags&sys.NIF_INFO != 0 {
+			t.Error("NIF_INFO is set")
+		}
+		if data.Flags&sys.NIF_ICON == 0 {
+			t.Error("NIF_ICON is not set")
+		}
+	}
+	// error
+	if err := ni.SetTip("\000"); err == nil {
+		t.Error("expected error")
+	}
+}
+
 func TestNotify(t *testing.T) {
 	ni, err := windows.New(name)
 	if err != nil {
@@ -280,6 +373,141 @@ func TestNotify(t *testing.T) {
 	}
 }
 
+func TestNotifyMultiline(t *testing.T) {
+	ni, err := windows.New(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ni.Close()
+
+	n := &windows.Notification{
+		Title: "Title",
+		Body:  "Line 1\r\nLine 2\nLine 3\rLine 4",
+		Sound: true,
+	}
+	data, err := ni.Info(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := syscall.UTF16ToString(data.Info[:]), "Line 1\nLine 2\nLine 3 Line 4"; g != e {
+		t.Errorf("expected %q, got %q", e, g)
+	}
+	if err := ni.Notify(n); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNotifyTimeout(t *testing.T) {
+	ni, err := windows.New(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ni.Close()
+
+	version := ni.Data().Version
+	for _, tt := range []struct {
+		shell   []uint32
+		timeout time.Duration
+		version uint32
+	}{
+		{[]uint32{5, 0, 0}, 0, version},
+		{[]uint32{5, 0, 0}, 5 * time.Second, 10000},
+		{[]uint32{5, 0, 0}, 20 * time.Second, 20000},
+		{[]uint32{5, 0, 0}, time.Minute, 30000},
+		{[]uint32{6, 0, 0}, 15 * time.Second, 15000},
+		{[]uint32{6, 0, 6}, 15 * time.Second, version},
+	} {
+		if tt.timeout > 0 {
+			windows.MockShellDLLVersion(tt.shell[0], tt.shell[1], tt.shell[2])
+		}
+		n := &windows.Notification{
+			Title:   "Title",
+			Body:    "Body",
+			Sound:   true,
+			Timeout: tt.timeout,
+		}
+		data, err := ni.Info(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, e := data.Version, tt.version; g != e {
+			t.Errorf("%v on shell %v: expected %v, got %v", tt.timeout, tt.shell, e, g)
+		}
+	}
+}
+
+func TestNotifyTimeoutVersion(t *testing.T) {
+	windows.MockShellDLLVersion(5, 0, 0)
+	windows.MockShellDLLVersion(5, 0, 0)
+	windows.MockShellDLLVersion(5, 0, 0)
+	ni, err := windows.New(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ni.Close()
+
+	icon, err := load()
+	if err != nil {
+		t.Error(err)
+	}
+	defer icon.Close()
+
+	// added by the first Notify
+	ni.Icon = icon
+	windows.MockShellDLLVersion(5, 0, 0)
+	n := &windows.Notification{
+		Title:   "Title",
+		Body:    "Body",
+		Sound:   true,
+		Timeout: 20 * time.Second,
+	}
+	if err := ni.Notify(n); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := windows.SetVersion(), uint32(sys.NOTIFY_VERSION); g != e {
+		t.Errorf("expected NIM_SETVERSION with %v, got %v", e, g)
+	}
+}
+
+func TestNotifySilent(t *testing.T) {
+	ni, err := windows.New(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ni.Close()
+
+	for _, tt := range []struct {
+		shell []uint32
+		flag  bool
+	}{
+		{[]uint32{6, 0, 0}, true},
+		{[]uint32{5, 0, 0}, false},
+		{[]uint32{4, 72, 0}, false},
+	} {
+		windows.MockShellDLLVersion(tt.shell[0], tt.shell[1], tt.shell[2])
+		n := &windows.Notification{
+			Title: "Title",
+			Body:  "No Sound",
+		}
+		data, err := ni.Info(n)
+		if err != nil {
+			t.Fatalf("shell %v: %v", tt.shell, err)
+		}
+		if g, e := data.InfoFlags&sys.NIIF_NOSOUND != 0, tt.flag; g != e {
+			t.Errorf("shell %v: NIIF_NOSOUND = %v, expected %v", tt.shell, g, e)
+		}
+	}
+	// ignored on Windows 2000
+	windows.MockShellDLLVersion(5, 0, 0)
+	n := &windows.Notification{
+		Title: "Title",
+		Body:  "No Sound",
+	}
+	if err := ni.Notify(n); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestNotifyError(t *testing.T) {
 	ni, err := windows.New(name)
 	if err != nil {
@@ -340,15 +568,6 @@ func TestNotifyError(t *testing.T) {
 	if err := ni.Notify(n); err == nil {
 		t.Error("expected error")
 	}
-	// NIIF_NOSOUND on Windows 2000
-	windows.MockShellDLLVersion(5, 0, 0)
-	n = &windows.Notification{
-		Title: "Title",
-		Body:  "No Sound",
-	}
-	if err := ni.Notify(n); err == nil {
-		t.Error("expected error")
-	}
 	// invalid GUID
 	windows.MockWindows7()
 	ni.GUID = "{XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX}"
@@ -375,6 +594,52 @@ func load() (*windows.Icon, error) {
 	return windows.LoadImage(img)
 }
 
+func TestIsServiceRunning(t *testing.T) {
+	if _, err := windows.IsServiceRunning(); err != nil {
+		t.Fatal(err)
+	}
+
+	service := func(name string, state uint32) syscall.ENUM_SERVICE_STATUS_PROCESS {
+		var s syscall.ENUM_SERVICE_STATUS_PROCESS
+		s.ServiceName, _ = syscall.UTF16PtrFromString(name)
+		s.ServiceStatusProcess.CurrentState = state
+		return s
+	}
+	for i, tt := range []struct {
+		services []syscall.ENUM_SERVICE_STATUS_PROCESS
+		e        bool
+	}{
+		// running
+		{[]syscall.ENUM_SERVICE_STATUS_PROCESS{service("WpnUserService_1a2b3", syscall.SERVICE_RUNNING)}, true},
+		// stopped
+		{[]syscall.ENUM_SERVICE_STATUS_PROCESS{service("WpnUserService_1a2b3", syscall.SERVICE_STOPPED)}, false},
+		// absent
+		{nil, true},
+		{[]syscall.ENUM_SERVICE_STATUS_PROCESS{service("WpnService", syscall.SERVICE_STOPPED)}, true},
+		// per-user instances
+		{
+			[]syscall.ENUM_SERVICE_STATUS_PROCESS{
+				service("WpnUserService", syscall.SERVICE_STOPPED),
+				service("WpnUserService_1a2b3", syscall.SERVICE_STOPPED),
+				service("WpnUserService_4c5d6", syscall.SERVICE_RUNNING),
+			},
+			true,
+		},
+		{
+			[]syscall.ENUM_SERVICE_STATUS_PROCESS{
+				service("WpnUserService", syscall.SERVICE_STOPPED),
+				service("WpnUserService_1a2b3", syscall.SERVICE_STOPPED),
+				service("WpnService", syscall.SERVICE_RUNNING),
+			},
+			false,
+		},
+	} {
+		if g := windows.IsServiceRunningIn(tt.services); g != tt.e {
+			t.Errorf("#%v: expected %v, got %v", i, tt.e, g)
+		}
+	}
+}
+
 func TestIconType(t *testing.T) {
 	for i, e := range []string{
 		"IconNone",
@@ -409,6 +674,61 @@ func TestLoadImage(t *testing.T) {
 	}
 }
 
+func BenchmarkLoadImage(b *testing.B) {
+	for _, bb := range []struct {
+		name string
+		img  image.Image
+	}{
+		{"Gray/16", image.NewGray(image.Rect(0, 0, 16, 16))},
+		{"Gray/256", image.NewGray(image.Rect(0, 0, 256, 256))},
+		{"NRGBA/16", image.NewNRGBA(image.Rect(0, 0, 16, 16))},
+		{"NRGBA/256", image.NewNRGBA(image.Rect(0, 0, 256, 256))},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				icon, err := windows.LoadImage(bb.img)
+				if err != nil {
+					b.Fatal(err)
+				}
+				icon.Close()
+			}
+		})
+	}
+}
+
+func TestLoadImageAsync(t *testing.T) {
+	ch := windows.LoadImageAsync(image.NewNRGBA(image.Rect(0, 0, 256, 256)))
+	r, ok := <-ch
+	switch {
+	case !ok:
+		t.Fatal("expected result")
+	case r.Err != nil:
+		t.Fatal(r.Err)
+	case r.Icon == nil:
+		t.Fatal("expected icon")
+	}
+	r.Icon.Close()
+	if _, ok := <-ch; ok {
+		t.Error("expected closed channel")
+	}
+
+	r = <-windows.LoadImageAsync(image.NewAlpha(image.Rect(0, 0, 32, 32)))
+	if r.Err == nil {
+		t.Error("expected error")
+	}
+}
+
+func BenchmarkLoadImageAsync(b *testing.B) {
+	img := image.NewNRGBA(image.Rect(0, 0, 256, 256))
+	for i := 0; i < b.N; i++ {
+		r := <-windows.LoadImageAsync(img)
+		if r.Err != nil {
+			b.Fatal(r.Err)
+		}
+		r.Icon.Close()
+	}
+}
+
 func TestLoadIcon(t *testing.T) {
 	icon, err := windows.LoadIcon(1)
 	if err != nil {
@@ -419,6 +739,25 @@ func TestLoadIcon(t *testing.T) {
 	}
 }
 
+func TestLoadIconSize(t *testing.T) {
+	icon, err := windows.LoadIconSize(1, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := windows.IconSize(), 16; g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if err := icon.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// error
+	for _, size := range []int{0, 257} {
+		if _, err := windows.LoadIconSize(1, size); err != windows.ErrIconSize {
+			t.Errorf("expected ErrIconSize, got %#v", err)
+		}
+	}
+}
+
 func TestGUID(t *testing.T) {
 	e := syscall.GUID{
 		Data1: 0x23977b55,
@@ -468,6 +807,72 @@ func TestGUIDError(t *testing.T) {
 	}
 }
 
+func TestActivateEvent(t *testing.T) {
+	for _, tt := range []struct {
+		mock func()
+		nin  []uintptr
+	}{
+		{
+			mock: func() {
+				windows.MockShellDLLVersion(6, 0, 6)
+			},
+			nin: []uintptr{
+				sys.NIN_SELECT,
+				sys.WM_LBUTTONUP,
+				sys.WM_LBUTTONDBLCLK,
+				sys.NIN_KEYSELECT,
+			},
+		},
+		{
+			mock: func() {
+				for i := 0; i < 3; i++ {
+					windows.MockShellDLLVersion(4, 0, 0)
+				}
+			},
+			nin: []uintptr{
+				sys.WM_LBUTTONUP,
+				sys.NIN_SELECT,
+				sys.WM_LBUTTONDBLCLK,
+				sys.NIN_KEYSELECT,
+			},
+		},
+	} {
+		tt.mock()
+		ni, err := windows.New(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, nin := range tt.nin {
+			if err := ni.PostMessage(sys.WM_USER, 0, nin); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, e := range []windows.ActivateEvent{
+			{Kind: windows.LeftClick},
+			{Kind: windows.DoubleClick},
+			{Kind: windows.KeyboardSelect},
+		} {
+			if g := <-ni.Activate; !reflect.DeepEqual(g, e) {
+				t.Errorf("expected %v, got %v", e, g)
+			}
+		}
+		ni.Close()
+	}
+
+	for i, e := range []string{
+		"LeftClick",
+		"DoubleClick",
+		"KeyboardSelect",
+		"ActivateKind(3)",
+	} {
+		if g := windows.ActivateKind(i).String(); g != e {
+			t.Errorf("ActivateKind.String() = %v, expected %v", g, e)
+		}
+	}
+}
+
 func TestBalloonEvent(t *testing.T) {
 	ni, err := windows.New(name)
 	if err != nil {
@@ -503,7 +908,8 @@ func TestBalloonEvent(t *testing.T) {
 		"BalloonShown",
 		"BalloonClosed",
 		"BalloonClicked",
-		"BalloonEvent(3)",
+		"BalloonSuppressed",
+		"BalloonEvent(4)",
 	} {
 		if g := windows.BalloonEvent(i).String(); g != e {
 			t.Errorf("BalloonEvent.String() = %v, expected %v", g, e)
@@ -511,6 +917,265 @@ func TestBalloonEvent(t *testing.T) {
 	}
 }
 
+func TestBalloonSuppressed(t *testing.T) {
+	ni, err := windows.New(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ni.Close()
+
+	ni.ShowTimeout = 100 * time.Millisecond
+	// suppressed
+	ni.AwaitShow()
+	select {
+	case g := <-ni.Balloon:
+		if e := windows.BalloonSuppressed; g != e {
+			t.Errorf("expected %v, got %v", e, g)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out")
+	}
+	// shown
+	ni.AwaitShow()
+	if err := ni.PostMessage(sys.WM_USER, 0, sys.NIN_BALLOONSHOW); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := <-ni.Balloon, windows.BalloonShown; g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	select {
+	case g := <-ni.Balloon:
+		t.Errorf("unexpected event: %v", g)
+	case <-time.After(3 * ni.ShowTimeout):
+	}
+}
+
+func TestNotifyQueue(t *testing.T) {
+	ni, err := windows.New(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ni.Close()
+
+	ni.MaxQueue = 2
+	for _, title := range []string{"1", "2", "3", "4"} {
+		if err := ni.Notify(&windows.Notification{Title: title, Body: "Body"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// drop oldest
+	if g, e := ni.Queue(), []string{"3", "4"}; !reflect.DeepEqual(g, e) {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	for _, e := range [][]string{{"4"}, nil} {
+		if err := ni.PostMessage(sys.WM_USER, 0, sys.NIN_BALLOONTIMEOUT); err != nil {
+			t.Fatal(err)
+		}
+		if g, e := <-ni.Balloon, windows.BalloonClosed; g != e {
+			t.Errorf("expected %v, got %v", e, g)
+		}
+		if g := ni.Queue(); !reflect.DeepEqual(g, e) {
+			t.Errorf("expected %v, got %v", e, g)
+		}
+	}
+	// drop newest
+	ni.DropPolicy = windows.DropNewest
+	for _, title := range []string{"5", "6"} {
+		if err := ni.Notify(&windows.Notification{Title: title, Body: "Body"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ni.Notify(&windows.Notification{Title: "7", Body: "Body"}); err != windows.ErrQueue {
+		t.Errorf("expected ErrQueue, got %#v", err)
+	}
+	if g, e := ni.Queue(), []string{"5", "6"}; !reflect.DeepEqual(g, e) {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+}
+
+func TestNotifyQueueStale(t *testing.T) {
+	ni, err := windows.New(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ni.Close()
+
+	ni.MaxQueue = 2
+	ni.ShowTimeout = time.Hour
+	for _, title := range []string{"1", "2", "3"} {
+		if err := ni.Notify(&windows.Notification{Title: title, Body: "Body"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	token := ni.Token()
+	if token == 0 {
+		t.Fatal("expected current balloon")
+	}
+	// the timer fires after the balloon is shown
+	if err := ni.PostMessage(sys.WM_USER, 0, sys.NIN_BALLOONSHOW); err != nil {
+		t.Fatal(err)
+	}
+	if err := ni.PostMessage(windows.WM_SHOWTIMEOUT, token, 0); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := <-ni.Balloon, windows.BalloonShown; g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	select {
+	case g := <-ni.Balloon:
+		t.Errorf("unexpected event: %v", g)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if g, e := ni.Queue(), []string{"2", "3"}; !reflect.DeepEqual(g, e) {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	// the timer of the closed balloon fires
+	if err := ni.PostMessage(sys.WM_USER, 0, sys.NIN_BALLOONTIMEOUT); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := <-ni.Balloon, windows.BalloonClosed; g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if err := ni.PostMessage(windows.WM_SHOWTIMEOUT, token, 0); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case g := <-ni.Balloon:
+		t.Errorf("unexpected event: %v", g)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if g, e := ni.Queue(), []string{"3"}; !reflect.DeepEqual(g, e) {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	// the timer of the current balloon fires
+	if err := ni.PostMessage(windows.WM_SHOWTIMEOUT, ni.Token(), 0); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := <-ni.Balloon, windows.BalloonSuppressed; g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if g := ni.Queue(); g != nil {
+		t.Errorf("expected nil, got %v", g)
+	}
+	// the shell shows the suppressed balloon late
+	token = ni.Token()
+	if err := ni.PostMessage(sys.WM_USER, 0, sys.NIN_BALLOONSHOW); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := <-ni.Balloon, windows.BalloonShown; g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if g, e := ni.Token(), token; g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+}
+
+func TestNotifyOnClickURL(t *testing.T) {
+	ni, err := windows.New(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ni.Close()
+
+	const u = "https://example.com/"
+	n := &windows.Notification{
+		Title:      "Title",
+		Body:       "Body",
+		OnClickURL: u,
+	}
+	if err := ni.Notify(n); err != nil {
+		t.Fatal(err)
+	}
+	if err := ni.PostMessage(sys.WM_USER, 0, sys.NIN_BALLOONUSERCLICK); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := <-ni.Balloon, windows.BalloonClicked; g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	select {
+	case g := <-windows.Executed():
+		if g != u {
+			t.Errorf("expected %q, got %q", u, g)
+		}
+	default:
+		t.Error("expected ShellExecute")
+	}
+	// clicked twice
+	if err := ni.PostMessage(sys.WM_USER, 0, sys.NIN_BALLOONUSERCLICK); err != nil {
+		t.Fatal(err)
+	}
+	<-ni.Balloon
+	// closed
+	if err := ni.Notify(n); err != nil {
+		t.Fatal(err)
+	}
+	if err := ni.PostMessage(sys.WM_USER, 0, sys.NIN_BALLOONTIMEOUT); err != nil {
+		t.Fatal(err)
+	}
+	<-ni.Balloon
+	if err := ni.PostMessage(sys.WM_USER, 0, sys.NIN_BALLOONUSERCLICK); err != nil {
+		t.Fatal(err)
+	}
+	<-ni.Balloon
+	select {
+	case g := <-windows.Executed():
+		t.Errorf("unexpected ShellExecute: %q", g)
+	default:
+	}
+	// error
+	for _, s := range []string{"file:///C:/Windows/notepad.exe", "notepad.exe", "%"} {
+		n.OnClickURL = s
+		if err := ni.Notify(n); err != windows.ErrURL {
+			t.Errorf("%q: expected ErrURL, got %#v", s, err)
+		}
+	}
+}
+
+func TestHotKey(t *testing.T) {
+	ni, err := windows.New(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ni.Close()
+
+	const VK_F24 = 0x87
+	if err := ni.RegisterHotKey(1, windows.ModControl|windows.ModAlt|windows.ModShift, VK_F24); err != nil {
+		t.Fatal(err)
+	}
+	lParam := uintptr(VK_F24)<<16 | uintptr(windows.ModControl|windows.ModAlt|windows.ModShift)
+	if err := ni.PostMessage(sys.WM_HOTKEY, 1, lParam); err != nil {
+		t.Fatal(err)
+	}
+	e := windows.HotKeyEvent{
+		ID:        1,
+		Modifiers: windows.ModControl | windows.ModAlt | windows.ModShift,
+		Key:       VK_F24,
+	}
+	if g := <-ni.HotKey; !reflect.DeepEqual(g, e) {
+		t.Errorf("expected %#v, got %#v", e, g)
+	}
+	if err := ni.UnregisterHotKey(1); err != nil {
+		t.Error(err)
+	}
+	// error
+	if err := ni.RegisterHotKey(0xc000, windows.ModControl, VK_F24); err != windows.ErrHotKeyID {
+		t.Errorf("expected ErrHotKeyID, got %#v", err)
+	}
+	if err := ni.UnregisterHotKey(1); err == nil {
+		t.Error("expected error")
+	}
+	// closed
+	if err := ni.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ni.RegisterHotKey(1, windows.ModControl, VK_F24); err != syscall.ERROR_INVALID_WINDOW_HANDLE {
+		t.Errorf("expected ERROR_INVALID_WINDOW_HANDLE, got %#v", err)
+	}
+	if err := ni.UnregisterHotKey(1); err != syscall.ERROR_INVALID_WINDOW_HANDLE {
+		t.Errorf("expected ERROR_INVALID_WINDOW_HANDLE, got %#v", err)
+	}
+}
+
 func TestMenu(t *testing.T) {
 	ni, err := windows.New(name)
 	if err != nil {
@@ -556,6 +1221,13 @@ func TestMenuError(t *testing.T) {
 	if _, err := menu.Sys(); err == nil {
 		t.Error("expected error")
 	}
+	// out of range
+	menu = ni.CreateMenu()
+	sub = menu.Submenu("Submenu")
+	sub.Item("Item", math.MaxUint16+1)
+	if _, err := menu.Sys(); err != windows.ErrMenuID {
+		t.Errorf("expected ErrMenuID, got %v", err)
+	}
 }
 
 func TestTaskbarCreated(t *testing.T) {
@@ -574,6 +1246,32 @@ func TestTaskbarCreated(t *testing.T) {
 	time.Sleep(time.Second)
 }
 
+func TestWindowThreadLock(t *testing.T) {
+	ni, err := windows.New(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ni.Close()
+
+	ni.Lock()
+	for _, msg := range []uint32{windows.WM_MODIFY, windows.WM_TASKBARCREATED} {
+		if err := ni.PostMessage(msg, 0, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		ni.UnregisterHotKey(1)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Error("the window thread is blocked")
+	}
+	ni.Unlock()
+}
+
 func TestVersionError(t *testing.T) {
 	for _, s := range []string{
 		"XP SP2",